@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+// Cache-Control of responses with an ETag. Clients may keep them
+// but must revalidate with If-None-Match before reusing them.
+const (
+	cacheControlPublic  = "no-cache"
+	cacheControlPrivate = "private, no-cache"
+)
+
+// errPreconditionFailed is the response to a conditional change
+// of a record the client doesn't have the current version of.
+var errPreconditionFailed = &apiError{
+	Status:  http.StatusPreconditionFailed,
+	Code:    codePrecondition,
+	Message: "Resource has changed, fetch it again before changing it",
+}
+
+// chirpsETag returns the entity tag of chirp lists at chirpsVersion.
+func chirpsETag(chirpsVersion int) string {
+	return `"chirps-` + strconv.Itoa(chirpsVersion) + `"`
+}
+
+// chirpETag returns the entity tag of chirp.
+func chirpETag(chirp database.Chirp) string {
+	return `"chirp-` + strconv.Itoa(chirp.ID) + "-" + strconv.Itoa(chirp.Version) + `"`
+}
+
+// userETag returns the entity tag of user.
+func userETag(user database.User) string {
+	return `"user-` + strconv.Itoa(user.ID) + "-" + strconv.Itoa(user.Version) + `"`
+}
+
+// checkNotModified sets the ETag and Cache-Control headers of the response
+// to r, a representation with entity tag tag. Responds with 304 Not Modified
+// and returns true if If-None-Match shows the client has it already.
+func checkNotModified(w http.ResponseWriter, r *http.Request, tag string, cacheControl string) bool {
+
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", cacheControl)
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" || !etagMatches(ifNoneMatch, tag, false) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ifMatchVersion checks the If-Match header of r against tag, the entity tag
+// of version of a record. Returns the version the database must still have
+// when changing the record, or 0 if r isn't conditional. Returns
+// errPreconditionFailed if the client's copy is out of date.
+func ifMatchVersion(r *http.Request, tag string, version int) (int, error) {
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return 0, nil
+	}
+	if !etagMatches(ifMatch, tag, true) {
+		return 0, errPreconditionFailed
+	}
+
+	return version, nil
+}
+
+// etagMatches reports whether the If-Match or If-None-Match header value
+// matches tag. If-Match compares strongly, so weak tags never match it.
+func etagMatches(header string, tag string, strong bool) bool {
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+func TestConditionalRequests(t *testing.T) {
+
+	ctx := context.Background()
+	doc := loadOpenAPIDoc(t)
+	cfg, _ := newTestConfig(t)
+	serveMux := cfg.newServeMux(".")
+
+	user, err := cfg.DB.CreateUser(ctx, "alice@example.com", "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = cfg.DB.ApplySubscriptionEvent(ctx, "evt_1", user.ID, database.EventUserUpgraded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.NewJWT(user.ID, cfg.jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := cfg.DB.CreateChirp(ctx, user.ID, "Hello", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// send makes a request with headers, checks the response is
+	// documented and has the expected status, and returns its ETag.
+	send := func(method, target, body string, headers map[string]string, status int) string {
+		t.Helper()
+
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		rec := httptest.NewRecorder()
+		serveMux.ServeHTTP(rec, req)
+		if rec.Code != status {
+			t.Fatalf("%s %s: expecting status %d, got %d: %s", method, target, status, rec.Code, rec.Body.String())
+		}
+
+		_, pattern := serveMux.Handler(req)
+		op, ok := doc.operation(pattern)
+		if !ok {
+			t.Fatalf("%s %s: route %q not documented", method, target, pattern)
+		}
+		err := doc.checkResponse(op, rec)
+		if err != nil {
+			t.Errorf("%s %s: %v", method, target, err)
+		}
+
+		return rec.Header().Get("ETag")
+	}
+
+	// Unchanged chirps aren't sent again
+	chirpPath := "/api/v1/chirps/" + strconv.Itoa(chirp.ID)
+	listTag := send("GET", "/api/v1/chirps", "", nil, http.StatusOK)
+	chirpTag := send("GET", chirpPath, "", nil, http.StatusOK)
+	pageTag := send("GET", "/api/v2/chirps", "", nil, http.StatusOK)
+	send("GET", "/api/v1/chirps", "", map[string]string{"If-None-Match": listTag}, http.StatusNotModified)
+	send("GET", chirpPath, "", map[string]string{"If-None-Match": `"other", W/` + chirpTag}, http.StatusNotModified)
+	send("GET", "/api/v2/chirps", "", map[string]string{"If-None-Match": pageTag}, http.StatusNotModified)
+
+	// Edits must be made to the current version
+	edit := `{"body":"Edited"}`
+	send("PUT", chirpPath, edit, map[string]string{"If-Match": "W/" + chirpTag}, http.StatusPreconditionFailed)
+	editedTag := send("PUT", chirpPath, edit, map[string]string{"If-Match": chirpTag}, http.StatusOK)
+	send("PUT", chirpPath, edit, map[string]string{"If-Match": chirpTag}, http.StatusPreconditionFailed)
+	if editedTag == chirpTag {
+		t.Errorf("Expecting edit to change ETag %s", chirpTag)
+	}
+
+	// Changed chirps are sent again
+	if send("GET", "/api/v1/chirps", "", map[string]string{"If-None-Match": listTag}, http.StatusOK) == listTag {
+		t.Error("Expecting edit to change chirps ETag")
+	}
+	send("GET", chirpPath, "", map[string]string{"If-None-Match": editedTag}, http.StatusNotModified)
+
+	// Same for users
+	userTag := send("GET", "/api/v1/users/me", "", nil, http.StatusOK)
+	send("GET", "/api/v1/users/me", "", map[string]string{"If-None-Match": userTag}, http.StatusNotModified)
+	update := `{"email":"alice@example.org","password":"longpassword"}`
+	updatedTag := send("PUT", "/api/v1/users", update, map[string]string{"If-Match": userTag}, http.StatusOK)
+	send("PUT", "/api/v1/users", update, map[string]string{"If-Match": userTag}, http.StatusPreconditionFailed)
+	send("PUT", "/api/v1/users", update, map[string]string{"If-Match": "*"}, http.StatusOK)
+	if send("GET", "/api/v1/users/me", "", map[string]string{"If-None-Match": updatedTag}, http.StatusOK) == updatedTag {
+		t.Error("Expecting update to change user ETag")
+	}
+}
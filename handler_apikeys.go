@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+type apiKeyResp struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func newAPIKeyResp(key database.APIKey) apiKeyResp {
+	return apiKeyResp{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+	}
+}
+
+// handlerCreateAPIKey mints a personal API key for the authenticated user.
+// The key itself is only returned once, the database only keeps its hash.
+func (cfg *apiConfig) handlerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+
+	// API keys cannot be used to mint more API keys
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// To store JSON data from request
+	type parameters struct {
+		Name      string     `json:"name" validate:"required,max=100"`
+		Scopes    []string   `json:"scopes" validate:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err = decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Validate parameters
+	for _, scope := range param.Scopes {
+		if !auth.ValidScope(scope) {
+			respondWithAPIError(w, newValidationError("Invalid API key", fieldError{Field: "scopes", Message: "invalid scope " + scope}))
+			return
+		}
+	}
+	if param.ExpiresAt != nil && !param.ExpiresAt.After(time.Now()) {
+		respondWithAPIError(w, newValidationError("Invalid API key", fieldError{Field: "expires_at", Message: "must be in the future"}))
+		return
+	}
+
+	// Generate the API key
+	apiKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating api key", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// Save hash of API key to database
+	prefix := apiKey[:len(auth.APIKeyPrefix)+6]
+	key, err := cfg.DB.CreateAPIKey(r.Context(), userID, param.Name, prefix, auth.HashToken(apiKey), param.Scopes, param.ExpiresAt)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating api key", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type validResp struct {
+		apiKeyResp
+		Key string `json:"key"`
+	}
+
+	respondWithJSON(w, http.StatusCreated, validResp{
+		apiKeyResp: newAPIKeyResp(key),
+		Key:        apiKey,
+	})
+}
+
+// handlerGetAPIKeys responds with the API keys of the authenticated user.
+func (cfg *apiConfig) handlerGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	keys, err := cfg.DB.GetAPIKeysByUserID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving api keys", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	resp := make([]apiKeyResp, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, newAPIKeyResp(key))
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerRevokeAPIKey deletes the API key with the ID in the request URL.
+// Ensures that users can only revoke their own API keys.
+func (cfg *apiConfig) handlerRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get requested keyID from URL path
+	keyID, err := strconv.Atoi(r.PathValue("keyID"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting keyID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = cfg.DB.RevokeAPIKey(r.Context(), userID, keyID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if errors.Is(err, database.ErrForbidden) {
+		respondWithError(w, http.StatusForbidden, "Unauthorized to revoke API key")
+		return
+	}
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
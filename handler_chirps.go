@@ -1,15 +1,22 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ahgr3y/chirpy/internal/auth"
 	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/entitlements"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+const (
+	defaultChirpsLimit = 50
+	maxChirpsLimit     = 100
 )
 
 // handlerPostChirp stores the chirp in the request body
@@ -17,57 +24,93 @@ import (
 // Ensures that only authenticated user can post chirps.
 func (cfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 
-	// Extract token from request header
-	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-
-	// Validate signature of token
-	// and retrieve user id if token is valid
-	idString, err := auth.ExtractIDFromToken(token, cfg.jwtSecret)
+	// Authenticate with JWT or an API key allowed to write chirps
+	userID, err := cfg.authenticateUser(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		log.Printf("Error extracting id from token: %s", err)
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Convert idString to int type
-	userID, err := strconv.Atoi(string(idString))
+	// Only users with a verified email can post chirps
+	user, err := cfg.DB.GetUser(r.Context(), userID)
 	if err != nil {
-		log.Printf("Error converting idString to int type: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		slog.WarnContext(r.Context(), "Error getting user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !user.EmailVerified {
+		respondWithError(w, http.StatusForbidden, "Email address not verified")
 		return
 	}
 
 	// To store JSON data from request
 	type chirpStructure struct {
-		Body string `json:"body"`
+		Body      string     `json:"body" validate:"required"`
+		ReplyToID int        `json:"reply_to_id" validate:"min=1"`
+		PublishAt *time.Time `json:"publish_at"`
 	}
 
 	// Parse JSON Chirp to chirpStructure
-	decoder := json.NewDecoder(r.Body)
 	chirpStruct := chirpStructure{}
-	err = decoder.Decode(&chirpStruct)
+	err = decodeJSON(w, r, &chirpStruct)
 	if err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
 		return
 	}
 
 	// Validate chirp body
-	cleanChirp, err := validateChirp(chirpStruct.Body)
+	cleanChirp, err := validateChirp(chirpStruct.Body, entitlements.ForUser(user).MaxChirpLength)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithAPIError(w, newValidationError("Invalid chirp", fieldError{Field: "body", Message: err.Error()}))
+		return
+	}
+
+	// Validate schedule
+	if chirpStruct.PublishAt != nil {
+		if !entitlements.ForUser(user).ScheduleChirps {
+			respondWithError(w, http.StatusForbidden, "Scheduling chirps requires Chirpy Red")
+			return
+		}
+		if !chirpStruct.PublishAt.After(time.Now()) {
+			respondWithAPIError(w, newValidationError("Invalid chirp", fieldError{Field: "publish_at", Message: "must be in the future"}))
+			return
+		}
+		if chirpStruct.PublishAt.After(time.Now().Add(maxScheduleAhead)) {
+			respondWithAPIError(w, newValidationError("Invalid chirp", fieldError{Field: "publish_at", Message: "must be within a year"}))
+			return
+		}
 	}
 
 	type validResp struct {
-		AuthorID    int    `json:"author_id"`
-		ID          int    `json:"id"`
-		CleanedBody string `json:"body"`
+		AuthorID    int        `json:"author_id"`
+		ID          int        `json:"id"`
+		CleanedBody string     `json:"body"`
+		ReplyToID   int        `json:"reply_to_id,omitempty"`
+		PublishAt   *time.Time `json:"publish_at,omitempty"`
+		Scheduled   bool       `json:"scheduled,omitempty"`
 	}
 
-	// Save chirp to database
-	chirpObj, err := cfg.DB.CreateChirp(userID, cleanChirp)
+	// Save chirp to database, scheduled chirps are published later
+	var chirpObj database.Chirp
+	if chirpStruct.PublishAt != nil {
+		chirpObj, err = cfg.DB.ScheduleChirp(r.Context(), userID, cleanChirp, chirpStruct.ReplyToID, *chirpStruct.PublishAt)
+	} else {
+		chirpObj, err = cfg.DB.CreateChirp(r.Context(), userID, cleanChirp, chirpStruct.ReplyToID)
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithAPIError(w, newValidationError("Invalid chirp", fieldError{Field: "reply_to_id", Message: "chirp replied to not found"}))
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong while creating chirp")
+		respondWithErr(w, r, err)
+		return
+	}
+
+	if chirpObj.Published() {
+		cfg.events.Publish(events.ChirpCreated, chirpObj)
+		cfg.notifyChirpCreated(r.Context(), chirpObj)
 	}
 
 	// Respond valid response
@@ -75,6 +118,9 @@ func (cfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 		AuthorID:    userID,
 		ID:          chirpObj.ID,
 		CleanedBody: cleanChirp,
+		ReplyToID:   chirpObj.ReplyToID,
+		PublishAt:   chirpObj.PublishAt,
+		Scheduled:   chirpObj.Scheduled,
 	})
 
 }
@@ -84,10 +130,92 @@ func (cfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 // all chirps created by author_id.
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 
+	chirps, tag, ok := cfg.queryChirps(w, r)
+	if !ok {
+		return
+	}
+	if checkNotModified(w, r, tag, cacheControlPublic) {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+// handlerGetChirpsPage responds with a page of the chirps handlerGetChirps
+// responds with. Pass next_cursor of a page as cursor to get the next one.
+func (cfg *apiConfig) handlerGetChirpsPage(w http.ResponseWriter, r *http.Request) {
+
+	chirps, tag, ok := cfg.queryChirps(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse pagination query parameters
+	query := r.URL.Query()
+	limit := defaultChirpsLimit
+	if limitString := query.Get("limit"); limitString != "" {
+		var err error
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxChirpsLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxChirpsLimit))
+			return
+		}
+	}
+	start := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		cursorID, err := strconv.Atoi(cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+
+		// Page starts after the chirp with the cursor ID
+		start = len(chirps)
+		for i, chirp := range chirps {
+			if chirp.ID == cursorID {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	type validResp struct {
+		Chirps     []database.Chirp `json:"chirps"`
+		NextCursor int              `json:"next_cursor,omitempty"`
+	}
+
+	resp := validResp{Chirps: chirps[start:]}
+	if len(resp.Chirps) > limit {
+		resp.Chirps = resp.Chirps[:limit]
+		resp.NextCursor = resp.Chirps[limit-1].ID
+	}
+	if checkNotModified(w, r, tag, cacheControlPublic) {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// queryChirps returns the chirps asked for by the author_id and sort query
+// parameters, and their entity tag. Responds with an error and returns false
+// if the parameters are invalid.
+func (cfg *apiConfig) queryChirps(w http.ResponseWriter, r *http.Request) ([]database.Chirp, string, bool) {
+
+	// Version is read first so chirps changed meanwhile
+	// get a new tag on the next request
+	chirpsVersion, err := cfg.DB.ChirpsVersion(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving chirps version", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return nil, "", false
+	}
+
 	// Retrieve chirps from database
-	dbChirps, err := cfg.DB.GetChirps()
+	dbChirps, err := cfg.DB.GetChirps(r.Context())
 	if err != nil {
-		log.Fatal(err)
+		slog.ErrorContext(r.Context(), "Error retrieving chirps", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return nil, "", false
 	}
 
 	// Create a copy of dbChirps
@@ -101,22 +229,25 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 
 		authorID, err := strconv.Atoi(idString)
 		if err != nil {
-			log.Printf("Error converting string to int: %s", err)
-			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
-			return
+			slog.WarnContext(r.Context(), "Error converting string to int", "error", err)
+			respondWithError(w, http.StatusBadRequest, "Invalid author_id")
+			return nil, "", false
 		}
 
-		chirps, err = cfg.DB.GetChirpsByID(authorID)
+		chirps, err = cfg.DB.GetChirpsByID(r.Context(), authorID)
 		if err != nil {
-			log.Printf("Error retrieving chirps: %s", err)
-			return
+			slog.ErrorContext(r.Context(), "Error retrieving chirps", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return nil, "", false
 		}
 	} else {
 		for _, dbChirp := range dbChirps {
 			chirps = append(chirps, database.Chirp{
-				AuthorID: dbChirp.AuthorID,
-				ID:       dbChirp.ID,
-				Body:     dbChirp.Body,
+				AuthorID:  dbChirp.AuthorID,
+				ID:        dbChirp.ID,
+				Body:      dbChirp.Body,
+				ReplyToID: dbChirp.ReplyToID,
+				Version:   dbChirp.Version,
 			})
 		}
 	}
@@ -129,7 +260,7 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 
 	database.SortChirpsByID(chirps, sortBy)
 
-	respondWithJSON(w, http.StatusOK, chirps)
+	return chirps, chirpsETag(chirpsVersion), true
 }
 
 // handlerChirpGetByID response with a chirp with the given id.
@@ -139,22 +270,120 @@ func (cfg *apiConfig) handlerChirpGetByID(w http.ResponseWriter, r *http.Request
 	stringID := r.PathValue("chirpID")
 	requestedID, err := strconv.Atoi(stringID)
 	if err != nil {
-		log.Printf("Error converting stringID to int: %s", err)
+		slog.WarnContext(r.Context(), "Error converting stringID to int", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
 
 	// Retrieve chirps from database.
-	chirp, err := cfg.DB.GetChirp(requestedID)
+	chirp, err := cfg.DB.GetChirp(r.Context(), requestedID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Failed to retrieve chirp")
+		respondWithErr(w, r, err)
+		return
+	}
+	if checkNotModified(w, r, chirpETag(chirp), cacheControlPublic) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, database.Chirp{
-		ID:   chirp.ID,
-		Body: chirp.Body,
-	})
+	respondWithJSON(w, http.StatusOK, chirp)
+}
+
+// handlerUpdateChirp replaces the body of the chirp with the ID in the request URL.
+// Editing is a Chirpy Red entitlement and only the author can edit a chirp.
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+
+	// Authenticate with JWT or an API key allowed to write chirps
+	userID, err := cfg.authenticateUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Check user is entitled to edit chirps
+	userEntitlements := entitlements.ForUser(user)
+	if !userEntitlements.EditChirps {
+		respondWithError(w, http.StatusForbidden, "Editing chirps requires Chirpy Red")
+		return
+	}
+
+	// Get user's requested chirpID from URL path
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting stringID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	// To store JSON data from request
+	type parameters struct {
+		Body string `json:"body" validate:"required"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err = decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Validate chirp body
+	cleanChirp, err := validateChirp(param.Body, userEntitlements.MaxChirpLength)
+	if err != nil {
+		respondWithAPIError(w, newValidationError("Invalid chirp", fieldError{Field: "body", Message: err.Error()}))
+		return
+	}
+
+	// Edits conditional on If-Match must be made to the version the client has
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		current, err := cfg.DB.GetChirp(r.Context(), chirpID)
+		if errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		if err != nil {
+			respondWithErr(w, r, err)
+			return
+		}
+
+		version, err = ifMatchVersion(r, chirpETag(current), current.Version)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Error checking If-Match", "error", err)
+			respondWithErr(w, r, err)
+			return
+		}
+	}
+
+	chirp, err := cfg.DB.UpdateChirp(r.Context(), userID, chirpID, cleanChirp, version)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if errors.Is(err, database.ErrForbidden) {
+		respondWithError(w, http.StatusForbidden, "Unauthorized to edit chirp")
+		return
+	}
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", chirpETag(chirp))
+	respondWithJSON(w, http.StatusOK, chirp)
 }
 
 func cleanBody(body string, profanities []string) string {
@@ -181,10 +410,9 @@ func cleanBody(body string, profanities []string) string {
 	return cleanedBody
 }
 
-func validateChirp(body string) (string, error) {
+func validateChirp(body string, maxChirpLength int) (string, error) {
 
 	// Chirp cannot be too long
-	const maxChirpLength = 140
 	if len(body) > maxChirpLength {
 		return "", errors.New("chirp is too long")
 	}
@@ -203,46 +431,63 @@ func validateChirp(body string) (string, error) {
 }
 
 // handlerDeleteChirpByID deletes a Chirp in database with
-// the associated ID in the request URL.
+// the associated ID in the request URL, or cancels it if it
+// is scheduled and not yet published.
 // Ensures that only authenticated and authorized user can delete chirp.
 func (cfg *apiConfig) handlerDeleteChirpByID(w http.ResponseWriter, r *http.Request) {
 
-	// Extract token from request header
-	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-
-	// Validate signature of token
-	// and retrieve user id if token is valid
-	idString, err := auth.ExtractIDFromToken(token, cfg.jwtSecret)
+	// Authenticate with JWT or an API key allowed to delete chirps
+	userID, err := cfg.authenticateUser(r, auth.ScopeChirpsDelete)
 	if err != nil {
-		log.Printf("Error extracting id from token: %s", err)
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Convert idString to int type
-	userID, err := strconv.Atoi(string(idString))
+	// Get user's requested chirpID from URL path
+	stringID := r.PathValue("chirpID")
+	chirpID, err := strconv.Atoi(stringID)
 	if err != nil {
-		log.Printf("Error converting idString to int type: %s", err)
+		slog.WarnContext(r.Context(), "Error converting stringID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	// Deleting an unpublished chirp cancels it
+	err = cfg.DB.CancelScheduledChirp(r.Context(), userID, chirpID)
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		slog.ErrorContext(r.Context(), "Error cancelling scheduled chirp", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	// Get user's requested chirpID from URL path
-	stringID := r.PathValue("chirpID")
-	chirpID, err := strconv.Atoi(stringID)
+	// Keep a copy of the chirp for subscribers
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 	if err != nil {
-		log.Printf("Error converting stringID to int: %s", err)
-		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		respondWithErr(w, r, err)
 		return
 	}
 
 	// Delete chirp.
-	err = cfg.DB.DeleteChirp(userID, chirpID)
-	if err != nil {
-		log.Printf("Error deleting chirp: %s", err)
+	err = cfg.DB.DeleteChirp(r.Context(), userID, chirpID)
+	if errors.Is(err, database.ErrForbidden) {
 		respondWithError(w, http.StatusForbidden, "Unauthorized to delete chirp")
 		return
 	}
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+
+	cfg.events.Publish(events.ChirpDeleted, chirp)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,6 +1,14 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/health"
+)
 
 // Readiness endpoint handler func
 func handlerReadinessGet(w http.ResponseWriter, r *http.Request) {
@@ -16,3 +24,55 @@ func handlerReadinessPost(w http.ResponseWriter, r *http.Request) {
 func handlerReadinessDelete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusMethodNotAllowed)
 }
+
+// handlerLivez reports the server is running. It doesn't check
+// dependencies, so a broken database doesn't get the process restarted.
+func handlerLivez(w http.ResponseWriter, r *http.Request) {
+
+	type validResp struct {
+		Status string `json:"status"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, validResp{
+		Status: health.StatusOK,
+	})
+}
+
+// handlerReadyz runs the registered health checks and responds with
+// their results, 503 if any failed or the server is shutting down.
+func (cfg *apiConfig) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+
+	report := cfg.health.Run(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		slog.WarnContext(r.Context(), "Server not ready", "status", report.Status)
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, status, report)
+}
+
+// registerHealthChecks registers the checks the server needs
+// to pass before it is ready to handle requests.
+func (cfg *apiConfig) registerHealthChecks() {
+
+	// Database file can be read and parsed
+	cfg.health.Register("database", 2*time.Second, cfg.DB.Ping)
+
+	// Database changes can be saved
+	cfg.health.Register("disk", 2*time.Second, cfg.DB.CheckWritable)
+
+	// Secrets needed to sign tokens and accept webhooks are set
+	cfg.health.Register("config", 0, func(ctx context.Context) error {
+		if cfg.jwtSecret == "" {
+			return errors.New("JWT_SECRET is not set")
+		}
+		if cfg.polkaKey == "" && cfg.polkaVerifier == nil {
+			return errors.New("POLKA_KEY or POLKA_WEBHOOK_SECRETS is not set")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+// chirpLike is the data of chirp.liked events.
+type chirpLike struct {
+	ChirpID  int `json:"chirp_id"`
+	AuthorID int `json:"author_id"`
+	UserID   int `json:"user_id"`
+}
+
+// handlerLikeChirp likes the chirp with the ID in the request URL
+// on behalf of the authenticated user. Liking twice has no effect.
+func (cfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get user's requested chirpID from URL path
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting chirpID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	_, created, err := cfg.DB.LikeChirp(r.Context(), userID, chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error liking chirp", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		cfg.events.Publish(events.ChirpLiked, chirpLike{
+			ChirpID:  chirp.ID,
+			AuthorID: chirp.AuthorID,
+			UserID:   userID,
+		})
+		if chirp.AuthorID != userID {
+			cfg.notify(r.Context(), chirp.AuthorID, database.NotificationLike, userID, chirp.ID)
+		}
+	}
+
+	cfg.respondWithLikes(r.Context(), w, status, chirpID)
+}
+
+// handlerUnlikeChirp removes the authenticated user's like
+// from the chirp with the ID in the request URL, and the
+// notification it sent the author.
+func (cfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get user's requested chirpID from URL path
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting chirpID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	err = cfg.DB.UnlikeChirp(r.Context(), userID, chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Like not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error unliking chirp", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondWithLikes responds with the number of likes of chirp with chirpID.
+func (cfg *apiConfig) respondWithLikes(ctx context.Context, w http.ResponseWriter, code int, chirpID int) {
+
+	likes, err := cfg.DB.CountChirpLikes(ctx, chirpID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting likes", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type validResp struct {
+		ChirpID int `json:"chirp_id"`
+		Likes   int `json:"likes"`
+	}
+
+	respondWithJSON(w, code, validResp{
+		ChirpID: chirpID,
+		Likes:   likes,
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+// Failed logins are tracked per account and per client IP.
+// Client IPs get more room since many users can share one.
+var (
+	accountLockoutPolicy = auth.LockoutPolicy{
+		Threshold:  5,
+		BaseDelay:  time.Second,
+		MaxDelay:   15 * time.Minute,
+		ResetAfter: 24 * time.Hour,
+	}
+	ipLockoutPolicy = auth.LockoutPolicy{
+		Threshold:  20,
+		BaseDelay:  time.Second,
+		MaxDelay:   15 * time.Minute,
+		ResetAfter: 24 * time.Hour,
+	}
+)
+
+func accountAttemptKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// reserveLogin counts a login for email and from the client IP as failed
+// until refundLogin takes it back, so parallel guesses can't slip past the
+// lockout. Responds with 429 and returns false if logins are locked.
+func (cfg *apiConfig) reserveLogin(w http.ResponseWriter, r *http.Request, email string) bool {
+
+	lockedUntil, err := cfg.DB.ReserveLoginAttempt(r.Context(), map[string]auth.LockoutPolicy{
+		accountAttemptKey(email): accountLockoutPolicy,
+		ipAttemptKey(r):          ipLockoutPolicy,
+	})
+	if err != nil && !errors.Is(err, database.ErrLoginLocked) {
+		// Failing closed would let a broken database lock everyone out
+		slog.ErrorContext(r.Context(), "Error reserving login attempt", "error", err)
+		return true
+	}
+
+	wait := time.Until(lockedUntil)
+	if err == nil || wait <= 0 {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+	return false
+}
+
+// refundLogin takes back the failed login reserveLogin counted
+// for email and the client IP, once the credentials are known to be right.
+func (cfg *apiConfig) refundLogin(r *http.Request, email string) {
+
+	err := cfg.DB.RefundLoginAttempt(r.Context(), accountAttemptKey(email), accountLockoutPolicy)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error refunding login attempt", "error", err)
+	}
+
+	err = cfg.DB.RefundLoginAttempt(r.Context(), ipAttemptKey(r), ipLockoutPolicy)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error refunding login attempt", "error", err)
+	}
+}
+
+// handlerUnlockUser clears the failed logins of the user with
+// the ID in the request URL. Only available to admins. Locks on client IPs
+// stay, those are shared by every account logging in from the IP and
+// lifting them for one user would lift them for whoever is guessing.
+func (cfg *apiConfig) handlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating admin", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get requested userID from URL path
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting userID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting user", "error", err)
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	err = cfg.DB.ClearLoginAttempts(r.Context(), accountAttemptKey(user.Email))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error clearing login attempts", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Message string `json:"message"`
+	}{
+		Message: fmt.Sprintf("User %d unlocked", user.ID),
+	})
+}
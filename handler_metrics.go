@@ -2,31 +2,34 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"net/http"
+	"strings"
+
+	"github.com/ahgr3y/chirpy/internal/metrics"
 )
 
+// handlerGetServerHits renders the metrics served at /metrics as a page for admins.
 func (cfg *apiConfig) handlerGetServerHits(w http.ResponseWriter, r *http.Request) {
+
+	text := strings.Builder{}
+	metrics.Default.WriteText(&text)
+
 	body := []byte(fmt.Sprintf(`<html>
 
 <body>
     <h1>Welcome, Chirpy Admin</h1>
     <p>Chirpy has been visited %d times!</p>
+    <p>%d API requests handled.</p>
+    <pre>%s</pre>
 </body>
 
-</html>`, cfg.fileserverHits))
+</html>`, fileserverHits.Sum(), httpRequests.Sum(), html.EscapeString(text.String())))
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
 	w.Write(body)
 }
 
-// Converts next to a Handler that increments fileserverHits
-func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits++
-		next.ServeHTTP(w, r)
-	})
-}
-
 // Prevent POST request to metrics route
 func (cfg *apiConfig) handlerPostServerHits(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusMethodNotAllowed)
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+const (
+	defaultNotificationsLimit = 20
+	maxNotificationsLimit     = 100
+)
+
+// handlerGetNotifications responds with a page of the authenticated user's
+// notifications, newest first, and how many are unread.
+// Query parameters: limit, before (next_before of the previous page)
+// and unread=true to only list unread notifications.
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse pagination query parameters
+	query := r.URL.Query()
+	limit := defaultNotificationsLimit
+	if limitString := query.Get("limit"); limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxNotificationsLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxNotificationsLimit))
+			return
+		}
+	}
+	beforeID := 0
+	if beforeString := query.Get("before"); beforeString != "" {
+		beforeID, err = strconv.Atoi(beforeString)
+		if err != nil || beforeID < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+	}
+	unreadOnly := query.Get("unread") == "true"
+
+	notifications, err := cfg.DB.GetNotifications(r.Context(), userID, beforeID, limit, unreadOnly)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving notifications", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	unread, err := cfg.DB.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error counting notifications", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type validResp struct {
+		Notifications []database.Notification `json:"notifications"`
+		UnreadCount   int                     `json:"unread_count"`
+		NextBefore    int                     `json:"next_before,omitempty"`
+	}
+
+	resp := validResp{
+		Notifications: notifications,
+		UnreadCount:   unread,
+	}
+
+	// A full page may be followed by another
+	if len(notifications) == limit {
+		resp.NextBefore = notifications[len(notifications)-1].ID
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerMarkNotificationsRead marks the authenticated user's notifications
+// with the ids in the request body as read, or all of them if all is true.
+func (cfg *apiConfig) handlerMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// To store JSON data from request
+	type parameters struct {
+		IDs []int `json:"ids"`
+		All bool  `json:"all"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err = decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Marking everything read must be asked for explicitly
+	if len(param.IDs) == 0 && !param.All {
+		respondWithAPIError(w, newValidationError("Provide ids or set all to true", fieldError{Field: "ids", Message: "is required unless all is true"}))
+		return
+	}
+	if param.All {
+		param.IDs = nil
+	}
+
+	marked, err := cfg.DB.MarkNotificationsRead(r.Context(), userID, param.IDs)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error marking notifications read", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	unread, err := cfg.DB.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error counting notifications", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type validResp struct {
+		Marked      int `json:"marked"`
+		UnreadCount int `json:"unread_count"`
+	}
+
+	respondWithJSON(w, http.StatusOK, validResp{
+		Marked:      marked,
+		UnreadCount: unread,
+	})
+}
+
+// notifyChirpCreated notifies the author of the chirp replied to
+// and the users mentioned in chirp. Authors are not notified of
+// their own chirps, and users are notified once per chirp.
+func (cfg *apiConfig) notifyChirpCreated(ctx context.Context, chirp database.Chirp) {
+
+	notified := []int{chirp.AuthorID}
+
+	if chirp.ReplyToID != 0 {
+		parent, err := cfg.DB.GetChirp(ctx, chirp.ReplyToID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting chirp replied to", "error", err)
+		} else if !slices.Contains(notified, parent.AuthorID) {
+			cfg.notify(ctx, parent.AuthorID, database.NotificationReply, chirp.AuthorID, chirp.ID)
+			notified = append(notified, parent.AuthorID)
+		}
+	}
+
+	handles := mentionedHandles(chirp.Body)
+	if len(handles) == 0 {
+		return
+	}
+
+	users, err := cfg.DB.GetUsers(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting users", "error", err)
+		return
+	}
+	for _, user := range users {
+		if user.Handle != "" && slices.Contains(handles, user.Handle) && !slices.Contains(notified, user.ID) {
+			cfg.notify(ctx, user.ID, database.NotificationMention, chirp.AuthorID, chirp.ID)
+			notified = append(notified, user.ID)
+		}
+	}
+}
+
+// notify saves a notification for user with userID. Failing to notify
+// does not fail the request that caused it, so errors are only logged.
+func (cfg *apiConfig) notify(ctx context.Context, userID int, kind string, actorID int, chirpID int) {
+	_, err := cfg.DB.CreateNotification(ctx, userID, kind, actorID, chirpID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating notification", "kind", kind, "notified_user_id", userID, "error", err)
+	}
+}
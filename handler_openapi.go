@@ -0,0 +1,19 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 description of every route.
+// Contract tests check responses of the API against it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handlerOpenAPI responds with the OpenAPI specification of the API.
+func handlerOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
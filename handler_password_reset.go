@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/mailer"
+)
+
+const passwordResetTTL = time.Hour
+
+// handlerRequestPasswordReset mails a password reset token to the
+// user with the email in the request body.
+// Always responds the same way so it can't be used to find out
+// which emails are registered.
+func (cfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+
+	// To store JSON data from request
+	type parameters struct {
+		Email string `json:"email" validate:"required,email,max=254"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err := decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Issue the token in the background so the response time
+	// doesn't depend on whether the email exists
+	user, err := cfg.DB.GetUserByEmail(r.Context(), param.Email)
+	if err == nil {
+		go func() {
+			err := cfg.sendPasswordResetEmail(context.WithoutCancel(r.Context()), user)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error sending password reset email", "error", err)
+			}
+		}()
+	}
+
+	type validResp struct {
+		Message string `json:"message"`
+	}
+
+	respondWithJSON(w, http.StatusAccepted, validResp{
+		Message: "If the email is registered, a password reset token has been sent to it.",
+	})
+}
+
+// sendPasswordResetEmail mails user a single-use password reset token.
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+
+	token, err := auth.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+
+	// Save hash of token, replacing any older token
+	err = cfg.DB.CreatePasswordReset(ctx, user.ID, auth.HashToken(token), time.Now().UTC().Add(passwordResetTTL))
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone requested a password reset for your Chirpy account. If this wasn't you, you can ignore this email.\n\nSend the token below with your new password to POST /api/v1/password-reset/confirm. The token expires in %s.\n\n%s\n",
+			passwordResetTTL, token),
+	})
+}
+
+// handlerConfirmPasswordReset sets a new password using a password reset token.
+// Revokes all refresh tokens of the user so existing sessions end.
+func (cfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+
+	// To store JSON data from request
+	type parameters struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err := decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Look up the token without using it up, so a password the
+	// policy rejects doesn't cost the user their token
+	tokenHash := auth.HashToken(param.Token)
+	reset, err := cfg.DB.GetPasswordReset(r.Context(), tokenHash)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting password reset token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired password reset token")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), reset.UserID)
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Enforce password policy
+	err = cfg.passwordPolicy.Validate(param.Password, user.Email)
+	if err != nil {
+		respondWithAPIError(w, newValidationError("Invalid password", fieldError{Field: "password", Message: err.Error()}))
+		return
+	}
+
+	// Hash the password
+	hashedPassword, err := auth.HashPassword(r.Context(), param.Password)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// Consume the token and update password together,
+	// fails if a parallel request used the token first
+	user, err = cfg.DB.ConsumePasswordReset(r.Context(), tokenHash, hashedPassword)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error consuming password reset token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired password reset token")
+		return
+	}
+
+	// End existing sessions
+	err = cfg.DB.RevokeUserRefreshTokens(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error revoking refresh tokens", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
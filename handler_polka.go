@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+// handlerPolkaWebhook applies subscription events sent by Polka
+// once a payment completes, fails or a subscription ends.
+// Ensure only Polka is able to use this API.
+func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
+
+	// Read raw body, signatures are computed over it
+	body, err := readBody(w, r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error reading request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Ensure request comes from Polka
+	err = cfg.verifyPolkaRequest(r, body)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error verifying polka webhook", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized request")
+		return
+	}
+
+	// To store JSON data from request. Events must have an id
+	// so retried deliveries can be told apart from new events
+	type parameters struct {
+		ID    string `json:"id" validate:"required"`
+		Event string `json:"event" validate:"required"`
+		Data  struct {
+			UserID int `json:"user_id" validate:"required,min=1"`
+		} `json:"data"`
+	}
+
+	// Parse JSON to parameters. Unknown fields are allowed
+	// so Polka can add fields to its payloads.
+	param := parameters{}
+	err = json.Unmarshal(body, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding JSON", "error", err)
+		respondWithErr(w, r, decodeError(err))
+		return
+	}
+	err = validate(&param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error validating request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Apply event, retried deliveries are skipped
+	user, applied, err := cfg.DB.ApplySubscriptionEvent(r.Context(), param.ID, param.Data.UserID, param.Event)
+	if errors.Is(err, database.ErrUnknownSubscriptionEvent) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error applying subscription event", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if !applied {
+		slog.InfoContext(r.Context(), "Skipped subscription event", "event_id", param.ID, "event", param.Event, "subscriber_id", param.Data.UserID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if param.Event == database.EventUserUpgraded {
+		cfg.notify(r.Context(), user.ID, database.NotificationUpgrade, 0, 0)
+	}
+
+	// Subscription events are published under the same name
+	cfg.events.Publish(param.Event, struct {
+		UserID             int    `json:"user_id"`
+		IsChirpyRed        bool   `json:"is_chirpy_red"`
+		SubscriptionStatus string `json:"subscription_status"`
+	}{
+		UserID:             user.ID,
+		IsChirpyRed:        user.IsChirpyRed,
+		SubscriptionStatus: user.SubscriptionStatus,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyPolkaRequest checks the webhook was sent by Polka.
+// Requests must be signed when webhook secrets are configured,
+// otherwise they must carry the Polka API key.
+func (cfg *apiConfig) verifyPolkaRequest(r *http.Request, body []byte) error {
+
+	if cfg.polkaVerifier != nil {
+		return cfg.polkaVerifier.Verify(r.Header, body)
+	}
+
+	if cfg.polkaKey == "" {
+		return errors.New("polka api key not configured")
+	}
+
+	// Extract apiKey from request header
+	apiKey, err := auth.ExtractApiKey(r.Header)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		return errors.New("invalid polka api key")
+	}
+
+	return nil
+}
+
+// handlerGetSubscriptions responds with the subscription and its history
+// of every user who ever subscribed. Only available to admins.
+// Pass the user_id query parameter to see a single user.
+func (cfg *apiConfig) handlerGetSubscriptions(w http.ResponseWriter, r *http.Request) {
+
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating admin", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Check if request parameter contains user_id
+	userID := 0
+	if idString := r.URL.Query().Get("user_id"); idString != "" {
+		userID, err = strconv.Atoi(idString)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Error converting user_id to int", "error", err)
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+	}
+
+	events, err := cfg.DB.GetSubscriptionEvents(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving subscription events", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type subscriptionResp struct {
+		UserID      int                          `json:"user_id"`
+		Email       string                       `json:"email"`
+		IsChirpyRed bool                         `json:"is_chirpy_red"`
+		Status      string                       `json:"status"`
+		StartedAt   *time.Time                   `json:"started_at,omitempty"`
+		EndedAt     *time.Time                   `json:"ended_at,omitempty"`
+		History     []database.SubscriptionEvent `json:"history"`
+	}
+
+	// Group history by user
+	subscriptions := map[int]*subscriptionResp{}
+	for _, event := range events {
+		subscription, exist := subscriptions[event.UserID]
+		if !exist {
+			user, err := cfg.DB.GetUser(r.Context(), event.UserID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error getting user", "subscriber_id", event.UserID, "error", err)
+				continue
+			}
+
+			subscription = &subscriptionResp{
+				UserID:      user.ID,
+				Email:       user.Email,
+				IsChirpyRed: user.IsChirpyRed,
+				Status:      user.SubscriptionStatus,
+				History:     []database.SubscriptionEvent{},
+			}
+			if !user.SubscriptionStartedAt.IsZero() {
+				subscription.StartedAt = &user.SubscriptionStartedAt
+			}
+			if !user.SubscriptionEndedAt.IsZero() {
+				subscription.EndedAt = &user.SubscriptionEndedAt
+			}
+			subscriptions[event.UserID] = subscription
+		}
+
+		subscription.History = append(subscription.History, event)
+	}
+
+	resp := make([]subscriptionResp, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		resp = append(resp, *subscription)
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].UserID < resp[j].UserID
+	})
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -3,7 +3,7 @@ package main
 import "net/http"
 
 func (cfg *apiConfig) handlerResetServerHits(w http.ResponseWriter, r *http.Request) {
-	cfg.fileserverHits = 0
+	fileserverHits.WithLabelValues().Reset()
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Server hits has been reset to 0."))
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+const (
+	// maxScheduleAhead is how far in the future chirps can be scheduled.
+	maxScheduleAhead = 365 * 24 * time.Hour
+
+	// publishInterval is how often scheduled chirps are checked.
+	publishInterval = 5 * time.Second
+)
+
+// handlerGetScheduledChirps responds with the authenticated user's
+// unpublished chirps, the next to be published first.
+func (cfg *apiConfig) handlerGetScheduledChirps(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chirps, err := cfg.DB.GetScheduledChirps(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving scheduled chirps", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+// runChirpPublisher publishes scheduled chirps when they are due
+// until ctx is cancelled. The schedule is kept in the database,
+// so chirps due while the server was down are published on start.
+func (cfg *apiConfig) runChirpPublisher(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cfg.publishDueChirps(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDueChirps publishes the chirps due at now as if they were just posted.
+func (cfg *apiConfig) publishDueChirps(ctx context.Context, now time.Time) {
+
+	chirps, err := cfg.DB.PublishDueChirps(ctx, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error publishing scheduled chirps", "error", err)
+		return
+	}
+
+	for _, chirp := range chirps {
+		slog.InfoContext(ctx, "Published scheduled chirp", "chirp_id", chirp.ID)
+		cfg.events.Publish(events.ChirpCreated, chirp)
+		cfg.notifyChirpCreated(ctx, chirp)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+const (
+	// streamBuffer is how many events a client may fall behind
+	// before its stream is closed. Clients resume with Last-Event-ID.
+	streamBuffer = 32
+
+	// streamHeartbeat keeps idle connections open through proxies.
+	streamHeartbeat = 15 * time.Second
+)
+
+// handlerStreamChirps streams created and deleted chirps as Server-Sent Events.
+// If author_id query parameter is provided, only chirps by author_id are sent.
+// Clients that reconnect with Last-Event-ID receive the chirps they missed.
+func (cfg *apiConfig) handlerStreamChirps(w http.ResponseWriter, r *http.Request) {
+
+	// Check if request parameter contains author_id
+	authorID := 0
+	if idString := r.URL.Query().Get("author_id"); idString != "" {
+		var err error
+		authorID, err = strconv.Atoi(idString)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Error converting author_id to int", "error", err)
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+	}
+
+	// Subscribe, replaying chirps missed by a reconnecting client
+	var sub *events.Subscription
+	missed := []events.Event{}
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID == "" {
+		sub = cfg.events.Subscribe(streamBuffer)
+	} else {
+		lastSeq, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Error parsing Last-Event-ID", "error", err)
+			respondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		sub, missed = cfg.events.SubscribeSince(lastSeq, streamBuffer)
+	}
+	defer sub.Close()
+
+	openStreams.Inc()
+	defer openStreams.Dec()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Ask clients to reconnect quickly when the stream is closed
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	for _, event := range missed {
+		err := writeChirpEvent(w, event, authorID)
+		if err != nil {
+			return
+		}
+	}
+	err := rc.Flush()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error flushing chirp stream", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-cfg.shutdown:
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-sub.Events():
+			// Client fell behind or the server is shutting down
+			if !ok {
+				return
+			}
+			err = writeChirpEvent(w, event, authorID)
+		}
+		if err != nil {
+			return
+		}
+
+		err = rc.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeChirpEvent writes event as a Server-Sent Event if it is a chirp event
+// by the author with authorID. An authorID of 0 matches every author.
+func writeChirpEvent(w http.ResponseWriter, event events.Event, authorID int) error {
+
+	if event.Type != events.ChirpCreated && event.Type != events.ChirpDeleted {
+		return nil
+	}
+
+	chirp, ok := event.Data.(database.Chirp)
+	if !ok || (authorID != 0 && chirp.AuthorID != authorID) {
+		return nil
+	}
+
+	data, err := json.Marshal(chirp)
+	if err != nil {
+		slog.Error("Error marshalling JSON", "error", err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+	return err
+}
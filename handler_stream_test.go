@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+func TestStreamChirps(t *testing.T) {
+
+	cfg := &apiConfig{events: events.NewBus()}
+	server := httptest.NewServer(http.HandlerFunc(cfg.handlerStreamChirps))
+	defer server.Close()
+	defer cfg.events.Close()
+
+	// readEvent returns the next event in the stream, skipping comments
+	readEvent := func(reader *bufio.Reader) []string {
+		lines := []string{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" && len(lines) > 0 {
+				return lines
+			}
+			if line != "" && !strings.HasPrefix(line, ":") && !strings.HasPrefix(line, "retry:") {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	connect := func(lastEventID string) *bufio.Reader {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"?author_id=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Unexpected content type %q", resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body)
+	}
+
+	stream := connect("")
+
+	// Only chirp events by the requested author are sent
+	cfg.events.Publish(events.ChirpCreated, database.Chirp{AuthorID: 2, ID: 1, Body: "other"})
+	cfg.events.Publish(events.UserUpgraded, nil)
+	cfg.events.Publish(events.ChirpCreated, database.Chirp{AuthorID: 1, ID: 2, Body: "hello"})
+	cfg.events.Publish(events.ChirpDeleted, database.Chirp{AuthorID: 1, ID: 2, Body: "hello"})
+
+	expected := []string{"id: 3", "event: chirp.created", `data: {"author_id":1,"id":2,"body":"hello"}`}
+	if event := readEvent(stream); strings.Join(event, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("%v != %v", event, expected)
+	}
+	if event := readEvent(stream); event[0] != "id: 4" || event[1] != "event: chirp.deleted" {
+		t.Errorf("Unexpected event %v", event)
+	}
+
+	// Reconnecting clients catch up from Last-Event-ID
+	resumed := connect("3")
+	if event := readEvent(resumed); event[0] != "id: 4" {
+		t.Errorf("Expecting replay from id 4, got %v", event)
+	}
+}
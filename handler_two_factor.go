@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/logging"
+)
+
+const recoveryCodeCount = 10
+
+// handlerEnrollTwoFactor starts two-factor enrollment for the authenticated user.
+// Responds with a new TOTP secret and its otpauth URI for authenticator apps.
+func (cfg *apiConfig) handlerEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating totp secret", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// Secret isn't used for login until enrollment is confirmed
+	err = cfg.DB.SetPendingTOTPSecret(r.Context(), userID, secret)
+	if errors.Is(err, database.ErrTwoFactorEnabled) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication already enabled")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving totp secret", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type validResp struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	respondWithJSON(w, http.StatusOK, validResp{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI("Chirpy", user.Email, secret),
+	})
+}
+
+// handlerConfirmTwoFactor enables two-factor login once the user proves
+// their authenticator works. Responds with single-use recovery codes.
+func (cfg *apiConfig) handlerConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// To store JSON data from request
+	type parameters struct {
+		Code string `json:"code" validate:"required"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err = decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+	if user.TwoFactorEnabled {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		respondWithError(w, http.StatusBadRequest, "Two-factor enrollment not started")
+		return
+	}
+
+	// Check code from authenticator
+	err = cfg.useTOTPCode(r.Context(), user, param.Code)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error validating totp code", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	// Generate recovery codes, only their hashes are saved
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating recovery codes", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	codeHashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		codeHashes = append(codeHashes, auth.HashToken(code))
+	}
+
+	err = cfg.DB.EnableTwoFactor(r.Context(), userID, codeHashes)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error enabling two-factor", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type validResp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	respondWithJSON(w, http.StatusOK, validResp{
+		RecoveryCodes: codes,
+	})
+}
+
+// handlerLoginTwoFactor completes a two-factor login with the challenge token
+// from POST /api/v1/login and either a TOTP code or a recovery code.
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	// To store JSON data from request
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token" validate:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err := decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+	if param.Code == "" && param.RecoveryCode == "" {
+		respondWithAPIError(w, newValidationError("Invalid request body", fieldError{Field: "code", Message: "is required unless recovery_code is set"}))
+		return
+	}
+
+	// Validate challenge token
+	idString, err := auth.ExtractIDFromChallengeToken(param.ChallengeToken, cfg.jwtSecret)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error validating challenge token", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge token")
+		return
+	}
+
+	userID, err := strconv.Atoi(idString)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting idString to int type", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge token")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil || !user.TwoFactorEnabled {
+		slog.WarnContext(r.Context(), "Error getting two-factor user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized access")
+		return
+	}
+	logging.SetUserID(r.Context(), user.ID)
+
+	// Second factor guesses count towards the lockout as well
+	if !cfg.reserveLogin(w, r, user.Email) {
+		return
+	}
+
+	// Check second factor
+	if param.RecoveryCode != "" {
+		codeHash := auth.HashToken(auth.NormalizeRecoveryCode(param.RecoveryCode))
+		err = cfg.DB.ConsumeRecoveryCode(r.Context(), user.ID, codeHash)
+	} else {
+		err = cfg.useTOTPCode(r.Context(), user, param.Code)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error validating second factor", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	cfg.refundLogin(r, user.Email)
+	err = cfg.DB.ClearLoginAttempts(r.Context(), accountAttemptKey(user.Email))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error clearing login attempts", "error", err)
+	}
+
+	cfg.respondWithSession(r.Context(), w, user)
+}
+
+// useTOTPCode checks code against the TOTP secret of user
+// and records it so the same code can't be used twice.
+func (cfg *apiConfig) useTOTPCode(ctx context.Context, user database.User, code string) error {
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return errors.New("invalid totp code")
+	}
+
+	return cfg.DB.UseTOTPStep(ctx, user.ID, step)
+}
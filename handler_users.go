@@ -1,121 +1,248 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/entitlements"
+	"github.com/ahgr3y/chirpy/internal/logging"
 )
 
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 
 	// To store JSON data from request
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Handle   string `json:"handle" validate:"min=3,max=30"`
+		Password string `json:"password" validate:"required"`
 	}
 
 	// Parse JSON to parameters
-	decoder := json.NewDecoder(r.Body)
 	param := parameters{}
-	err := decoder.Decode(&param)
+	err := decodeJSON(w, r, &param)
 	if err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Handles are optional, users without one can't be mentioned
+	param.Handle, err = normalizeHandle(param.Handle)
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Enforce password policy
+	err = cfg.passwordPolicy.Validate(param.Password, param.Email)
+	if err != nil {
+		respondWithAPIError(w, newValidationError("Invalid password", fieldError{Field: "password", Message: err.Error()}))
 		return
 	}
 
 	// Hash the password
-	hashedPassword, err := auth.HashPassword(param.Password)
+	hashedPassword, err := auth.HashPassword(r.Context(), param.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
+		slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
 	// Save chirp to database
-	user, err := cfg.DB.CreateUser(param.Email, hashedPassword)
+	user, err := cfg.DB.CreateUser(r.Context(), param.Email, param.Handle, hashedPassword)
 	if err != nil {
-		log.Printf("Error creating user: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong while creating user")
+		respondWithErr(w, r, err)
 		return
 	}
 
+	// Ask user to confirm their email address
+	err = cfg.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error sending verification email", "error", err)
+	}
+
 	type validResp struct {
-		ID          int    `json:"id"`
-		Email       string `json:"email"`
-		IsChirpyRed bool   `json:"is_chirpy_red"`
+		ID            int    `json:"id"`
+		Email         string `json:"email"`
+		Handle        string `json:"handle"`
+		IsChirpyRed   bool   `json:"is_chirpy_red"`
+		EmailVerified bool   `json:"email_verified"`
 	}
 
 	// Respond valid response
 	respondWithJSON(w, http.StatusCreated, validResp{
-		ID:          user.ID,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		Email:         user.Email,
+		Handle:        user.Handle,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerified,
 	})
 
 }
 
+// handlerGetCurrentUser responds with the profile of the authenticated user,
+// including their tier and what it entitles them to.
+func (cfg *apiConfig) handlerGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting user", "error", err)
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if checkNotModified(w, r, userETag(user), cacheControlPrivate) {
+		return
+	}
+
+	userEntitlements := entitlements.ForUser(user)
+
+	type validResp struct {
+		ID               int                       `json:"id"`
+		Email            string                    `json:"email"`
+		Handle           string                    `json:"handle"`
+		IsChirpyRed      bool                      `json:"is_chirpy_red"`
+		EmailVerified    bool                      `json:"email_verified"`
+		TwoFactorEnabled bool                      `json:"two_factor_enabled"`
+		Tier             entitlements.Tier         `json:"tier"`
+		Entitlements     entitlements.Entitlements `json:"entitlements"`
+	}
+
+	respondWithJSON(w, http.StatusOK, validResp{
+		ID:               user.ID,
+		Email:            user.Email,
+		Handle:           user.Handle,
+		IsChirpyRed:      user.IsChirpyRed,
+		EmailVerified:    user.EmailVerified,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		Tier:             userEntitlements.Tier,
+		Entitlements:     userEntitlements,
+	})
+}
+
 func (cfg *apiConfig) handlerUsersLogin(w http.ResponseWriter, r *http.Request) {
 
 	// To store JSON data from request
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Password string `json:"password" validate:"required"`
 	}
 
 	// Parse JSON request body to parameters
-	decoder := json.NewDecoder(r.Body)
 	param := parameters{}
-	err := decoder.Decode(&param)
+	err := decodeJSON(w, r, &param)
 	if err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Stop here if too many logins failed recently, otherwise
+	// count this one as failed until the password is checked
+	if !cfg.reserveLogin(w, r, param.Email) {
 		return
 	}
 
 	// Authenticate user
-	user, err := cfg.DB.AuthenticateUser(param.Email, param.Password)
+	user, err := cfg.DB.AuthenticateUser(r.Context(), param.Email, param.Password)
 	if err != nil {
-		log.Printf("Error authenticating user: %s", err)
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized access")
 		return
 	}
+	logging.SetUserID(r.Context(), user.ID)
+	cfg.refundLogin(r, param.Email)
+
+	// Upgrade hashes made with an outdated algorithm or cost
+	// while the plain password is at hand
+	if auth.PasswordNeedsRehash(user.Password) {
+		hashedPassword, err := auth.HashPassword(r.Context(), param.Password)
+		if err == nil {
+			user, err = cfg.DB.UpdateUserPassword(r.Context(), user.ID, hashedPassword)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error rehashing password", "error", err)
+		}
+	}
+
+	// Ask for the second factor before issuing tokens
+	if user.TwoFactorEnabled {
+		challengeToken, err := auth.NewTwoFactorChallengeJWT(user.ID, cfg.jwtSecret)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error creating challenge token", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+
+		type challengeResp struct {
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			ChallengeToken    string `json:"challenge_token"`
+		}
+
+		respondWithJSON(w, http.StatusOK, challengeResp{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	// Forget earlier failures once the password is known
+	err = cfg.DB.ClearLoginAttempts(r.Context(), accountAttemptKey(user.Email))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error clearing login attempts", "error", err)
+	}
+
+	cfg.respondWithSession(r.Context(), w, user)
+}
+
+// respondWithSession issues a JWT and a refresh token to a user who
+// completed login and responds with them.
+func (cfg *apiConfig) respondWithSession(ctx context.Context, w http.ResponseWriter, user database.User) {
 
 	// Create a signedJWT
 	signedJWT, err := auth.NewJWT(user.ID, cfg.jwtSecret)
 	if err != nil {
-		log.Printf("Error creating JWT: %s", err)
+		slog.ErrorContext(ctx, "Error creating JWT", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
 	// Create RefreshToken
-	refreshToken, err := cfg.DB.CreateRefreshToken(user.ID)
+	refreshToken, err := cfg.DB.CreateRefreshToken(ctx, user.ID)
 	if err != nil {
-		log.Printf("Error generating refresh token: %s", err)
+		slog.ErrorContext(ctx, "Error generating refresh token", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
 	type validResp struct {
-		ID           int    `json:"id"`
-		Email        string `json:"email"`
-		IsChirpyRed  bool   `json:"is_chirpy_red"`
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
+		ID            int    `json:"id"`
+		Email         string `json:"email"`
+		IsChirpyRed   bool   `json:"is_chirpy_red"`
+		EmailVerified bool   `json:"email_verified"`
+		Token         string `json:"token"`
+		RefreshToken  string `json:"refresh_token"`
 	}
 
 	// Respond valid response
 	respondWithJSON(w, http.StatusOK, validResp{
-		ID:           user.ID,
-		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
-		Token:        signedJWT,
-		RefreshToken: refreshToken.Token,
+		ID:            user.ID,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerified,
+		Token:         signedJWT,
+		RefreshToken:  refreshToken.Token,
 	})
 
 }
@@ -125,17 +252,24 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 
 	// To store JSON data from request
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Handle   string `json:"handle" validate:"min=3,max=30"`
+		Password string `json:"password" validate:"required"`
 	}
 
 	// Parse JSON to parameters
-	decoder := json.NewDecoder(r.Body)
 	param := parameters{}
-	err := decoder.Decode(&param)
+	err := decodeJSON(w, r, &param)
 	if err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Leaving the handle out keeps the current one
+	param.Handle, err = normalizeHandle(param.Handle)
+	if err != nil {
+		respondWithErr(w, r, err)
 		return
 	}
 
@@ -146,7 +280,7 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 	// and retrieve user id if token is valid
 	idString, err := auth.ExtractIDFromToken(token, cfg.jwtSecret)
 	if err != nil {
-		log.Printf("Error extracting id from token: %s", err)
+		slog.WarnContext(r.Context(), "Error extracting id from token", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
@@ -154,45 +288,72 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 	// Convert idString to its int equivalent
 	id, err := strconv.Atoi(idString)
 	if err != nil {
-		log.Printf("Error converting int to string: %s", err)
+		slog.ErrorContext(r.Context(), "Error converting int to string", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	logging.SetUserID(r.Context(), id)
 
 	// Get user from id.
-	user, err := cfg.DB.GetUser(id)
+	user, err := cfg.DB.GetUser(r.Context(), id)
 	if err != nil {
-		log.Printf("Error getting user: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Updates conditional on If-Match must be made to the version the client has
+	version, err := ifMatchVersion(r, userETag(user), user.Version)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error checking If-Match", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Enforce password policy
+	err = cfg.passwordPolicy.Validate(param.Password, param.Email)
+	if err != nil {
+		respondWithAPIError(w, newValidationError("Invalid password", fieldError{Field: "password", Message: err.Error()}))
 		return
 	}
 
 	// Hash the password
-	hashedPassword, err := auth.HashPassword(param.Password)
+	hashedPassword, err := auth.HashPassword(r.Context(), param.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
+		slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	// Update user email and password
-	updatedUser, err := cfg.DB.UpdateUserEmailPassword(id, param.Email, hashedPassword, user.IsChirpyRed)
+	// Update user email, handle and password
+	updatedUser, err := cfg.DB.UpdateUserEmailPassword(r.Context(), id, param.Email, param.Handle, hashedPassword, version)
 	if err != nil {
-		log.Printf("Error updating user: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		respondWithErr(w, r, err)
 		return
 	}
 
+	// Ask user to confirm their new email address
+	if updatedUser.Email != user.Email {
+		err = cfg.sendVerificationEmail(r.Context(), updatedUser)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error sending verification email", "error", err)
+		}
+	}
+
 	type validResp struct {
-		ID          int    `json:"id"`
-		Email       string `json:"email"`
-		IsChirpyRed bool   `json:"is_chirpy_red"`
+		ID            int    `json:"id"`
+		Email         string `json:"email"`
+		Handle        string `json:"handle"`
+		IsChirpyRed   bool   `json:"is_chirpy_red"`
+		EmailVerified bool   `json:"email_verified"`
 	}
 
+	w.Header().Set("ETag", userETag(updatedUser))
 	respondWithJSON(w, http.StatusOK, validResp{
-		ID:          updatedUser.ID,
-		Email:       updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed,
+		ID:            updatedUser.ID,
+		Email:         updatedUser.Email,
+		Handle:        updatedUser.Handle,
+		IsChirpyRed:   updatedUser.IsChirpyRed,
+		EmailVerified: updatedUser.EmailVerified,
 	})
 }
 
@@ -202,9 +363,9 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 
 	// Renew JWT
-	token, err := cfg.DB.RenewJWT(token, cfg.jwtSecret)
+	token, err := cfg.DB.RenewJWT(r.Context(), token, cfg.jwtSecret)
 	if err != nil {
-		log.Printf("Error renewing JWT: %s", err)
+		slog.WarnContext(r.Context(), "Error renewing JWT", "error", err)
 		respondWithError(w, http.StatusUnauthorized, "Token doesn't exist or expired")
 		return
 	}
@@ -227,74 +388,12 @@ func (cfg *apiConfig) handlerRevokeRefreshToken(w http.ResponseWriter, r *http.R
 	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 
 	// Revoke refresh token
-	err := cfg.DB.RevokeRefreshToken(token)
+	err := cfg.DB.RevokeRefreshToken(r.Context(), token)
 	if err != nil {
-		log.Printf("Error revoking refresh token: %s", err)
+		slog.WarnContext(r.Context(), "Error revoking refresh token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Something went wrong")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
-
-// handlerUpgradeUser upgrades the user provided by the polka webhook once
-// payment is complete.
-// Ensure only Polka is able to use this API.
-func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request) {
-
-	// Extract apiKey from request header
-	apiKey, err := auth.ExtractApiKey(r.Header)
-	if err != nil {
-		log.Printf("Error extracting api key: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find api key")
-		return
-	}
-
-	// Ensure request comes from Polka
-	if apiKey != cfg.polkaKey {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized request")
-		return
-	}
-
-	// To store JSON data from request
-	type parameters struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID int `json:"user_id"`
-		} `json:"data"`
-	}
-
-	// Parse JSON to parameters
-	decoder := json.NewDecoder(r.Body)
-	param := parameters{}
-	err = decoder.Decode(&param)
-	if err != nil {
-		log.Printf("Error decoding JSON: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
-		return
-	}
-
-	// Validate event.
-	if param.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	// Check if user exist.
-	_, err = cfg.DB.GetUser(param.Data.UserID)
-	if err != nil {
-		log.Printf("Error getting user: %s", err)
-		respondWithError(w, http.StatusNotFound, "User not found")
-		return
-	}
-
-	// Upgrade user status
-	err = cfg.DB.UpgradeUser(param.Data.UserID)
-	if err != nil {
-		log.Printf("Error upgrading user: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
-}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/mailer"
+)
+
+// sendVerificationEmail mails user a single-use token
+// to verify their email address.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+
+	// Generate id of the token so it can only be used once
+	tokenID, err := auth.GenerateSecureToken(16)
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.NewEmailVerificationJWT(user.ID, tokenID, cfg.jwtSecret)
+	if err != nil {
+		return err
+	}
+
+	// Save pending verification, replacing any older token
+	err = cfg.DB.CreateEmailVerification(ctx, user.ID, user.Email, tokenID)
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\nVerify your email address by sending the token below to POST /api/v1/users/verify. The token expires in %s.\n\n%s\n",
+			auth.EmailVerificationTTL, token),
+	})
+}
+
+// handlerVerifyEmail marks the email address of a user as verified
+// using the token from the verification email.
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	// To store JSON data from request
+	type parameters struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err := decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Validate signature and expiry of token
+	idString, tokenID, err := auth.ExtractEmailVerificationClaims(param.Token, cfg.jwtSecret)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error validating verification token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	userID, err := strconv.Atoi(idString)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting idString to int type", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	// Consume the token
+	user, err := cfg.DB.VerifyEmail(r.Context(), userID, tokenID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error verifying email", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	type validResp struct {
+		ID            int    `json:"id"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+
+	respondWithJSON(w, http.StatusOK, validResp{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	})
+}
+
+// handlerResendVerification mails a new verification token
+// to the authenticated user.
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := cfg.authenticateUser(r, "")
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithErr(w, r, err)
+		return
+	}
+
+	if user.EmailVerified {
+		respondWithError(w, http.StatusConflict, "Email already verified")
+		return
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error sending verification email", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+// webhookSecretPrefix marks webhook signing secrets.
+const webhookSecretPrefix = "whsec_"
+
+type webhookResp struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newWebhookResp(sub database.WebhookSubscription) webhookResp {
+	subEvents := sub.Events
+	if subEvents == nil {
+		subEvents = []string{}
+	}
+
+	return webhookResp{
+		ID:        sub.ID,
+		URL:       sub.URL,
+		Events:    subEvents,
+		CreatedAt: sub.CreatedAt,
+	}
+}
+
+// handlerCreateWebhook registers a url to receive events.
+// The signing secret is only returned once. Only available to admins.
+func (cfg *apiConfig) handlerCreateWebhook(w http.ResponseWriter, r *http.Request) {
+
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating admin", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// To store JSON data from request
+	type parameters struct {
+		URL    string   `json:"url" validate:"required,url"`
+		Events []string `json:"events" validate:"required"`
+	}
+
+	// Parse JSON to parameters
+	param := parameters{}
+	err = decodeJSON(w, r, &param)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		respondWithErr(w, r, err)
+		return
+	}
+
+	// Validate parameters, the url was checked while decoding
+	target, err := url.Parse(param.URL)
+	if err != nil {
+		respondWithAPIError(w, newValidationError("Invalid webhook", fieldError{Field: "url", Message: err.Error()}))
+		return
+	}
+	for _, eventType := range param.Events {
+		if !slices.Contains(events.Types, eventType) {
+			respondWithAPIError(w, newValidationError("Invalid webhook", fieldError{Field: "events", Message: "invalid event " + eventType}))
+			return
+		}
+	}
+
+	// Generate the signing secret
+	secret, err := auth.GenerateSecureToken(32)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating webhook secret", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	secret = webhookSecretPrefix + secret
+
+	sub, err := cfg.DB.CreateWebhookSubscription(r.Context(), target.String(), param.Events, secret)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating webhook", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	type validResp struct {
+		webhookResp
+		Secret string `json:"secret"`
+	}
+
+	respondWithJSON(w, http.StatusCreated, validResp{
+		webhookResp: newWebhookResp(sub),
+		Secret:      secret,
+	})
+}
+
+// handlerGetWebhooks responds with every registered webhook. Only available to admins.
+func (cfg *apiConfig) handlerGetWebhooks(w http.ResponseWriter, r *http.Request) {
+
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating admin", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	subs, err := cfg.DB.GetWebhookSubscriptions(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving webhooks", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	resp := make([]webhookResp, 0, len(subs))
+	for _, sub := range subs {
+		resp = append(resp, newWebhookResp(sub))
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerDeleteWebhook deletes the webhook with the ID in the request URL
+// and drops its pending deliveries. Only available to admins.
+func (cfg *apiConfig) handlerDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating admin", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get requested webhookID from URL path
+	webhookID, err := strconv.Atoi(r.PathValue("webhookID"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting webhookID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	err = cfg.DB.DeleteWebhookSubscription(r.Context(), webhookID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting webhook", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerGetWebhookDeliveries responds with the deliveries of the webhook
+// with the ID in the request URL, newest first, including every attempt.
+// Only available to admins.
+func (cfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating admin", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get requested webhookID from URL path
+	webhookID, err := strconv.Atoi(r.PathValue("webhookID"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error converting webhookID to int", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	_, err = cfg.DB.GetWebhookSubscription(r.Context(), webhookID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting webhook", "error", err)
+		respondWithError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	deliveries, err := cfg.DB.GetWebhookDeliveries(r.Context(), webhookID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving webhook deliveries", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+	"github.com/ahgr3y/chirpy/internal/logging"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsSendQueue is how many messages may wait for a slow client
+	// before its connection is closed.
+	wsSendQueue = 64
+
+	wsWriteWait    = 10 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsPingInterval = wsPongWait * 9 / 10
+	wsMaxMessage   = 4096
+	wsMaxTopics    = 50
+)
+
+// Topics clients can subscribe to.
+// Chirps by an author are "author:<id>".
+const (
+	wsTopicAuthorPrefix = "author:"
+	wsTopicMentions     = "mentions"
+	wsTopicLikes        = "likes"
+)
+
+// Errors sent to clients subscribing to topics.
+var (
+	errInvalidTopic  = errors.New("invalid topic")
+	errTooManyTopics = errors.New("too many topics")
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// handlerWebSocket checks the origin before authenticating
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsClientMessage is a message sent by clients.
+// Type is "subscribe", "unsubscribe" or "ping".
+type wsClientMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+}
+
+// wsServerMessage is a message sent to clients.
+// Type is "event", "subscribed", "unsubscribed", "pong" or "error".
+type wsServerMessage struct {
+	Type  string        `json:"type"`
+	Topic string        `json:"topic,omitempty"`
+	Event *events.Event `json:"event,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// wsClient is a connected WebSocket client.
+// Only the write loop writes to conn, everything else queues on send.
+type wsClient struct {
+	ctx    context.Context
+	conn   *websocket.Conn
+	userID int
+	handle string
+	send   chan wsServerMessage
+
+	mu     sync.Mutex
+	topics map[string]struct{}
+
+	closeOnce sync.Once
+	closeMsg  []byte
+	done      chan struct{}
+}
+
+// handlerWebSocket upgrades the request to a WebSocket connection
+// that pushes events on the topics the client subscribes to.
+// Authenticate with a JWT in the Authorization header, or in the
+// token query parameter for browsers which cannot set headers.
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+
+	// Browsers let any page open WebSockets, refuse pages the
+	// server doesn't trust before they can try tokens they got hold of
+	if !cfg.wsOriginAllowed(r) {
+		slog.WarnContext(r.Context(), "Refused websocket from untrusted origin", "origin", r.Header.Get("Origin"))
+		respondWithError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+
+	// Authenticate user before upgrading
+	var userID int
+	var err error
+	if token := r.URL.Query().Get("token"); token != "" {
+		userID, err = cfg.userIDFromToken(token)
+		logging.SetUserID(r.Context(), userID)
+	} else {
+		userID, err = cfg.userIDFromJWT(r)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error authenticating user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting user", "error", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Upgrader responds with an error itself
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error upgrading to websocket", "error", err)
+		return
+	}
+
+	client := &wsClient{
+		ctx:    r.Context(),
+		conn:   conn,
+		userID: user.ID,
+		handle: user.Handle,
+		send:   make(chan wsServerMessage, wsSendQueue),
+		topics: map[string]struct{}{},
+		done:   make(chan struct{}),
+	}
+
+	sub := cfg.events.Subscribe(wsSendQueue)
+	defer sub.Close()
+
+	openWebSockets.Inc()
+	defer openWebSockets.Dec()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		client.writeLoop()
+	}()
+	go func() {
+		defer wg.Done()
+		client.eventLoop(sub, cfg.shutdown)
+	}()
+
+	client.readLoop()
+	client.close(websocket.CloseNormalClosure, "")
+	wg.Wait()
+}
+
+// wsOriginAllowed reports whether r may open a WebSocket. Requests without
+// an Origin don't come from browsers, others must come from the server's
+// own origin or one of the origins in WS_ALLOWED_ORIGINS.
+func (cfg *apiConfig) wsOriginAllowed(r *http.Request) bool {
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(originURL.Host, r.Host) {
+		return true
+	}
+
+	return slices.ContainsFunc(cfg.wsAllowedOrigins, func(allowed string) bool {
+		return strings.EqualFold(allowed, origin)
+	})
+}
+
+// readLoop handles messages from the client until the connection fails.
+func (c *wsClient) readLoop() {
+
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		msg := wsClientMessage{}
+		err := c.conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.WarnContext(c.ctx, "Error reading websocket message", "error", err)
+			}
+			return
+		}
+
+		// Any message shows the client is alive
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		switch msg.Type {
+		case "ping":
+			c.queue(wsServerMessage{Type: "pong"})
+		case "subscribe":
+			err := c.subscribe(msg.Topic)
+			if err != nil {
+				c.queue(wsServerMessage{Type: "error", Topic: msg.Topic, Error: err.Error()})
+				continue
+			}
+			c.queue(wsServerMessage{Type: "subscribed", Topic: msg.Topic})
+		case "unsubscribe":
+			c.mu.Lock()
+			delete(c.topics, msg.Topic)
+			c.mu.Unlock()
+			c.queue(wsServerMessage{Type: "unsubscribed", Topic: msg.Topic})
+		default:
+			c.queue(wsServerMessage{Type: "error", Error: "Unknown message type: " + msg.Type})
+		}
+	}
+}
+
+// writeLoop writes queued messages and pings to the client until it is closed.
+func (c *wsClient) writeLoop() {
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err := c.conn.WriteJSON(msg)
+			if err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage, c.closeMsg, time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+// eventLoop queues events on the topics the client subscribed to
+// until the client disconnects or shutdown is closed.
+func (c *wsClient) eventLoop(sub *events.Subscription, shutdown <-chan struct{}) {
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-shutdown:
+			c.close(websocket.CloseGoingAway, "Reconnect to continue receiving events")
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Server is shutting down or the client fell behind
+				c.close(websocket.CloseGoingAway, "Reconnect to continue receiving events")
+				return
+			}
+
+			for _, topic := range c.topicsFor(event) {
+				c.queue(wsServerMessage{Type: "event", Topic: topic, Event: &event})
+			}
+		}
+	}
+}
+
+// subscribe adds topic to the topics of the client.
+func (c *wsClient) subscribe(topic string) error {
+
+	if !validWSTopic(topic) {
+		return errInvalidTopic
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.topics) >= wsMaxTopics {
+		return errTooManyTopics
+	}
+	c.topics[topic] = struct{}{}
+
+	return nil
+}
+
+// topicsFor returns the topics the client subscribed to that event belongs to.
+func (c *wsClient) topicsFor(event events.Event) []string {
+
+	candidates := []string{}
+	switch data := event.Data.(type) {
+	case database.Chirp:
+		candidates = append(candidates, wsTopicAuthorPrefix+strconv.Itoa(data.AuthorID))
+		if event.Type == events.ChirpCreated && data.AuthorID != c.userID &&
+			slices.Contains(mentionedHandles(data.Body), c.handle) {
+			candidates = append(candidates, wsTopicMentions)
+		}
+	case chirpLike:
+		if data.AuthorID == c.userID && data.UserID != c.userID {
+			candidates = append(candidates, wsTopicLikes)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	topics := []string{}
+	for _, topic := range candidates {
+		if _, exist := c.topics[topic]; exist {
+			topics = append(topics, topic)
+		}
+	}
+
+	return topics
+}
+
+// queue adds msg to the send queue. Clients too slow to
+// keep up with their queue are disconnected.
+func (c *wsClient) queue(msg wsServerMessage) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	default:
+		c.close(websocket.ClosePolicyViolation, "Send queue full")
+	}
+}
+
+// close stops the client, sending a close frame with code and reason.
+func (c *wsClient) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeMsg = websocket.FormatCloseMessage(code, reason)
+		close(c.done)
+	})
+}
+
+// validWSTopic reports whether clients can subscribe to topic.
+func validWSTopic(topic string) bool {
+
+	if topic == wsTopicMentions || topic == wsTopicLikes {
+		return true
+	}
+
+	idString, ok := strings.CutPrefix(topic, wsTopicAuthorPrefix)
+	if !ok {
+		return false
+	}
+	authorID, err := strconv.Atoi(idString)
+	return err == nil && authorID > 0
+}
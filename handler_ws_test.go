@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.CreateUser(context.Background(), "alice@example.com", "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.NewJWT(user.ID, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &apiConfig{DB: db, jwtSecret: "secret", events: events.NewBus(), wsAllowedOrigins: []string{"https://chirpy.example"}}
+	server := httptest.NewServer(http.HandlerFunc(cfg.handlerWebSocket))
+	defer server.Close()
+	defer cfg.events.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// Connections without a valid token are refused
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL+"?token=invalid", nil)
+	if err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expecting 401 without valid token, got %v", err)
+	}
+
+	// Pages of untrusted sites can't connect, even with a valid token
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL+"?token="+token, http.Header{"Origin": {"https://evil.example"}})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expecting 403 from untrusted origin, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token="+token, http.Header{"Origin": {"https://chirpy.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	send := func(msg wsClientMessage) {
+		err := conn.WriteJSON(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func() wsServerMessage {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		msg := wsServerMessage{}
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	send(wsClientMessage{Type: "ping"})
+	if msg := receive(); msg.Type != "pong" {
+		t.Errorf("Expecting pong, got %+v", msg)
+	}
+
+	send(wsClientMessage{Type: "subscribe", Topic: "author:abc"})
+	if msg := receive(); msg.Type != "error" {
+		t.Errorf("Expecting error subscribing to invalid topic, got %+v", msg)
+	}
+
+	for _, topic := range []string{"author:2", wsTopicMentions, wsTopicLikes} {
+		send(wsClientMessage{Type: "subscribe", Topic: topic})
+		if msg := receive(); msg.Type != "subscribed" || msg.Topic != topic {
+			t.Errorf("Expecting subscribed to %s, got %+v", topic, msg)
+		}
+	}
+
+	// Unsubscribed topics and likes by others on others' chirps are not sent
+	cfg.events.Publish(events.ChirpCreated, database.Chirp{AuthorID: 3, ID: 1, Body: "unrelated"})
+	cfg.events.Publish(events.ChirpLiked, chirpLike{ChirpID: 1, AuthorID: 3, UserID: 2})
+
+	cfg.events.Publish(events.ChirpCreated, database.Chirp{AuthorID: 2, ID: 2, Body: "hi @Alice!"})
+	cfg.events.Publish(events.ChirpLiked, chirpLike{ChirpID: 5, AuthorID: user.ID, UserID: 2})
+
+	expected := []string{"author:2", wsTopicMentions, wsTopicLikes}
+	for _, topic := range expected {
+		msg := receive()
+		if msg.Type != "event" || msg.Topic != topic || msg.Event == nil {
+			t.Errorf("Expecting event on %s, got %+v", topic, msg)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// APIKeyPrefix is prepended to every personal API key so
+// leaked keys are easy to recognise.
+const APIKeyPrefix = "chirpy_"
+
+// Scopes that can be granted to a personal API key.
+const (
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeChirpsDelete = "chirps:delete"
+)
+
+// ValidScope reports whether scope can be granted to an API key.
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeChirpsWrite, ScopeChirpsDelete:
+		return true
+	}
+	return false
+}
+
+// GenerateSecureToken returns n bytes of random data as a hex string.
+func GenerateSecureToken(n int) (string, error) {
+
+	bytes := make([]byte, n)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of token.
+// Only suitable for high entropy tokens, use HashPassword for passwords.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey returns a new personal API key.
+func GenerateAPIKey() (string, error) {
+
+	token, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + token, nil
+}
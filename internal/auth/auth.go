@@ -1,33 +1,48 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/ahgr3y/chirpy/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 
-func HashPassword(password string) (string, error) {
+var tracer = otel.Tracer("github.com/ahgr3y/chirpy/internal/auth")
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
+// HashPassword hashes password with the configured PasswordHasher.
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.StartChild(ctx, tracer, "auth.hash_password",
+		trace.WithAttributes(attribute.String("auth.algorithm", passwordHasher.Algorithm)))
+	defer span.End()
 
-	return string(hashedPassword), nil
+	defer passwordDuration.WithLabelValues("hash").ObserveSince(time.Now())
+	return passwordHasher.Hash(password)
 }
 
-func AuthenticatePassword(hashedPassword string, password string) error {
+// AuthenticatePassword checks password against hashedPassword.
+// Hashes made with any supported algorithm or cost are accepted.
+func AuthenticatePassword(ctx context.Context, hashedPassword string, password string) error {
+	_, span := tracing.StartChild(ctx, tracer, "auth.compare_password")
+	defer span.End()
 
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	if err != nil {
-		return err
-	}
+	defer passwordDuration.WithLabelValues("compare").ObserveSince(time.Now())
+	err := comparePassword(hashedPassword, password)
+	span.SetAttributes(attribute.Bool("auth.match", err == nil))
+	return err
+}
 
-	return nil
+// PasswordNeedsRehash reports whether hashedPassword should be replaced
+// with a hash from the configured PasswordHasher.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	return passwordHasher.NeedsRehash(hashedPassword)
 }
 
 // ExtractApiKey extracts the api key from headers.
@@ -0,0 +1,31 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long login is blocked after repeated failures.
+// Once Threshold failures are reached, each further failure doubles the
+// wait, starting at BaseDelay and capped at MaxDelay.
+type LockoutPolicy struct {
+	Threshold  int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	ResetAfter time.Duration
+}
+
+// Backoff returns how long login is blocked after failures consecutive failures.
+func (p LockoutPolicy) Backoff(failures int) time.Duration {
+
+	if failures < p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	return delay
+}
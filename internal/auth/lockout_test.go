@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyBackoff(t *testing.T) {
+
+	policy := LockoutPolicy{
+		Threshold: 3,
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+	}
+
+	cases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0, expected: 0},
+		{failures: 2, expected: 0},
+		{failures: 3, expected: time.Second},
+		{failures: 4, expected: 2 * time.Second},
+		{failures: 8, expected: 32 * time.Second},
+		{failures: 9, expected: time.Minute},
+		{failures: 100, expected: time.Minute},
+	}
+
+	for _, c := range cases {
+		delay := policy.Backoff(c.failures)
+		if delay != c.expected {
+			t.Errorf("%v failures: %v != %v", c.failures, delay, c.expected)
+		}
+	}
+}
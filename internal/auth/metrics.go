@@ -0,0 +1,16 @@
+package auth
+
+import "github.com/ahgr3y/chirpy/internal/metrics"
+
+// passwordDuration times hashing and checking passwords,
+// which is deliberately slow and dominates login latency.
+var passwordDuration = metrics.NewHistogramVec(
+	"chirpy_password_hash_duration_seconds",
+	"Time taken to hash or check a password.",
+	metrics.DefaultBuckets,
+	"operation",
+)
+
+func init() {
+	metrics.Default.MustRegister(passwordDuration)
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms supported by PasswordHasher.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHasher hashes passwords with the configured algorithm and cost.
+type PasswordHasher struct {
+	Algorithm  string
+	BcryptCost int
+
+	// Argon2id parameters, memory is in KiB
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// DefaultPasswordHasher is used until SetPasswordHasher is called.
+var DefaultPasswordHasher = PasswordHasher{
+	Algorithm:     AlgorithmBcrypt,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Time:    1,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 4,
+}
+
+var passwordHasher = DefaultPasswordHasher
+
+// SetPasswordHasher changes how HashPassword hashes new passwords.
+// Must be called before the server starts handling requests.
+func SetPasswordHasher(h PasswordHasher) error {
+
+	switch h.Algorithm {
+	case AlgorithmBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgorithmArgon2id:
+		if h.Argon2Time == 0 || h.Argon2Memory == 0 || h.Argon2Threads == 0 {
+			return errors.New("argon2id parameters must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("unknown password hashing algorithm %q", h.Algorithm)
+	}
+
+	passwordHasher = h
+	return nil
+}
+
+// Hash hashes password with the algorithm of h.
+func (h PasswordHasher) Hash(password string) (string, error) {
+
+	if h.Algorithm == AlgorithmArgon2id {
+		salt := make([]byte, argon2SaltLength)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, h.Argon2Time, h.Argon2Memory, h.Argon2Threads, argon2KeyLength)
+
+		// PHC string format, as used by the reference implementation
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.Argon2Memory, h.Argon2Time, h.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashedPassword), nil
+}
+
+// NeedsRehash reports whether hashedPassword was created with a different
+// algorithm or cost than h would use.
+func (h PasswordHasher) NeedsRehash(hashedPassword string) bool {
+
+	if strings.HasPrefix(hashedPassword, "$argon2id$") {
+		if h.Algorithm != AlgorithmArgon2id {
+			return true
+		}
+
+		params, _, _, err := decodeArgon2Hash(hashedPassword)
+		if err != nil {
+			return true
+		}
+
+		return params.Argon2Time != h.Argon2Time || params.Argon2Memory != h.Argon2Memory || params.Argon2Threads != h.Argon2Threads
+	}
+
+	if h.Algorithm != AlgorithmBcrypt {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		return true
+	}
+
+	return cost != h.BcryptCost
+}
+
+// comparePassword checks password against hashedPassword,
+// whichever supported algorithm created it.
+func comparePassword(hashedPassword string, password string) error {
+
+	if !strings.HasPrefix(hashedPassword, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	}
+
+	params, salt, key, err := decodeArgon2Hash(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return errors.New("argon2id: password does not match hash")
+	}
+
+	return nil
+}
+
+// decodeArgon2Hash parses an argon2id hash in PHC string format.
+func decodeArgon2Hash(hashedPassword string) (PasswordHasher, []byte, []byte, error) {
+
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return PasswordHasher{}, nil, nil, errors.New("argon2id: malformed hash")
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return PasswordHasher{}, nil, nil, errors.New("argon2id: unsupported version")
+	}
+
+	params := PasswordHasher{Algorithm: AlgorithmArgon2id}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Threads)
+	if err != nil {
+		return PasswordHasher{}, nil, nil, errors.New("argon2id: malformed parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return PasswordHasher{}, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return PasswordHasher{}, nil, nil, err
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrWeakPassword is wrapped by every PasswordPolicy violation.
+var ErrWeakPassword = errors.New("weak password")
+
+// PasswordPolicy is the set of rules new passwords must follow.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is in bytes, bcrypt ignores everything past 72 bytes
+	MaxLength int
+	Blocklist map[string]struct{}
+}
+
+// LoadPasswordBlocklist reads common or breached passwords from the file
+// at path, one per line. Empty lines and lines starting with # are skipped.
+func LoadPasswordBlocklist(path string) (map[string]struct{}, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	blocklist := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+
+	return blocklist, scanner.Err()
+}
+
+// Validate checks password of user with email against the policy.
+func (p PasswordPolicy) Validate(password string, email string) error {
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, p.MaxLength)
+	}
+
+	// Password can't be the email or its local part
+	lowerPassword := strings.ToLower(password)
+	lowerEmail := strings.ToLower(email)
+	localPart, _, _ := strings.Cut(lowerEmail, "@")
+	if lowerEmail != "" && (lowerPassword == lowerEmail || lowerPassword == localPart) {
+		return fmt.Errorf("%w: must not be your email address", ErrWeakPassword)
+	}
+
+	if _, blocked := p.Blocklist[lowerPassword]; blocked {
+		return fmt.Errorf("%w: too common, choose another password", ErrWeakPassword)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordHasher(t *testing.T) {
+
+	bcryptHasher := PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: 4}
+	argon2Hasher := PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+
+	for _, h := range []PasswordHasher{bcryptHasher, argon2Hasher} {
+		hashedPassword, err := h.Hash("correct horse battery staple")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := comparePassword(hashedPassword, "correct horse battery staple"); err != nil {
+			t.Errorf("%s: expecting password to match: %s", h.Algorithm, err)
+		}
+		if err := comparePassword(hashedPassword, "wrong password"); err == nil {
+			t.Errorf("%s: expecting wrong password to be rejected", h.Algorithm)
+		}
+		if h.NeedsRehash(hashedPassword) {
+			t.Errorf("%s: expecting no rehash with same parameters", h.Algorithm)
+		}
+	}
+
+	// Changing algorithm or cost requires a rehash
+	hashedPassword, err := bcryptHasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !argon2Hasher.NeedsRehash(hashedPassword) {
+		t.Error("Expecting bcrypt hash to need rehash with argon2id")
+	}
+	if !(PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: 5}).NeedsRehash(hashedPassword) {
+		t.Error("Expecting bcrypt hash to need rehash with higher cost")
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+
+	policy := PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 72,
+		Blocklist: map[string]struct{}{"password123": {}},
+	}
+
+	cases := []struct {
+		password string
+		valid    bool
+	}{
+		{password: "", valid: false},
+		{password: "short", valid: false},
+		{password: "Password123", valid: false},
+		{password: "sanji@onepiece.com", valid: false},
+		{password: "SANJI-COOKS", valid: true},
+		{password: "sanjisanji", valid: true},
+		{password: string(make([]byte, 73)), valid: false},
+	}
+
+	for _, c := range cases {
+		err := policy.Validate(c.password, "sanji@onepiece.com")
+		if c.valid && err != nil {
+			t.Errorf("%q: unexpected error: %s", c.password, err)
+		}
+		if !c.valid && !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("%q: expecting ErrWeakPassword, got %v", c.password, err)
+		}
+	}
+}
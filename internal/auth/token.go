@@ -8,14 +8,86 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Issuers keep tokens minted for one purpose from being accepted for another.
+const (
+	issuerAccess            = "chirpy"
+	issuerEmailVerification = "chirpy-email-verification"
+	issuerTwoFactor         = "chirpy-2fa-challenge"
+)
+
+// EmailVerificationTTL is how long an email verification token stays valid.
+const EmailVerificationTTL = 24 * time.Hour
+
+// TwoFactorChallengeTTL is how long a user has to complete
+// the second step of a two-factor login.
+const TwoFactorChallengeTTL = 5 * time.Minute
+
 func NewJWT(id int, secretKey string) (string, error) {
+	return newSignedJWT(issuerAccess, strconv.Itoa(id), "", time.Second*3600, secretKey)
+}
+
+// ExtractIDFromToken validates token using secretKey.
+// Returns id of user if token is valid.
+func ExtractIDFromToken(token string, secretKey string) (string, error) {
+
+	claims, err := parseJWT(token, issuerAccess, secretKey)
+	if err != nil {
+		return "", err
+	}
+
+	return claims.Subject, nil
+}
+
+// NewEmailVerificationJWT creates a token proving ownership of the
+// email address of user with id. tokenID identifies the token so it
+// can only be used once.
+func NewEmailVerificationJWT(id int, tokenID string, secretKey string) (string, error) {
+	return newSignedJWT(issuerEmailVerification, strconv.Itoa(id), tokenID, EmailVerificationTTL, secretKey)
+}
+
+// ExtractEmailVerificationClaims validates an email verification token.
+// Returns the id of the user and the id of the token if token is valid.
+func ExtractEmailVerificationClaims(token string, secretKey string) (string, string, error) {
+
+	claims, err := parseJWT(token, issuerEmailVerification, secretKey)
+	if err != nil {
+		return "", "", err
+	}
+	if claims.ID == "" {
+		return "", "", errors.New("missing token id")
+	}
+
+	return claims.Subject, claims.ID, nil
+}
+
+// NewTwoFactorChallengeJWT creates a token proving user with id
+// passed the password step of a two-factor login.
+func NewTwoFactorChallengeJWT(id int, secretKey string) (string, error) {
+	return newSignedJWT(issuerTwoFactor, strconv.Itoa(id), "", TwoFactorChallengeTTL, secretKey)
+}
+
+// ExtractIDFromChallengeToken validates a two-factor challenge token.
+// Returns id of user if token is valid.
+func ExtractIDFromChallengeToken(token string, secretKey string) (string, error) {
+
+	claims, err := parseJWT(token, issuerTwoFactor, secretKey)
+	if err != nil {
+		return "", err
+	}
+
+	return claims.Subject, nil
+}
+
+// newSignedJWT creates a JWT for subject signed with secretKey.
+func newSignedJWT(issuer string, subject string, tokenID string, ttl time.Duration, secretKey string) (string, error) {
 
 	// Create a JWT
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
+		Issuer:    issuer,
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Second * 3600)),
-		Subject:   strconv.Itoa(id),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(ttl)),
+		Subject:   subject,
+		ID:        tokenID,
 	})
 
 	// Sign the token
@@ -27,33 +99,23 @@ func NewJWT(id int, secretKey string) (string, error) {
 	return signedJWT, nil
 }
 
-// ExtractIDFromToken validates token using secretKey.
-// Returns id of user if token is valid.
-func ExtractIDFromToken(token string, secretKey string) (string, error) {
+// parseJWT validates the signature, expiry and issuer of token.
+// Returns the claims of token if token is valid.
+func parseJWT(token string, issuer string, secretKey string) (jwt.RegisteredClaims, error) {
 
 	claimsStruct := jwt.RegisteredClaims{}
 
 	// Validate signature of token
-	// and retrieve user id if token is valid
-	validToken, err := jwt.ParseWithClaims(token, &claimsStruct, func(t *jwt.Token) (interface{}, error) {
+	_, err := jwt.ParseWithClaims(token, &claimsStruct, func(t *jwt.Token) (interface{}, error) {
 		return []byte(secretKey), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
-		return "", err
+		return jwt.RegisteredClaims{}, err
 	}
 
-	idString, err := validToken.Claims.GetSubject()
-	if err != nil {
-		return "", err
-	}
-
-	issuer, err := validToken.Claims.GetIssuer()
-	if err != nil {
-		return "", err
-	}
-	if issuer != "chirpy" {
-		return "", errors.New("invalid issuer")
+	if claimsStruct.Issuer != issuer {
+		return jwt.RegisteredClaims{}, errors.New("invalid issuer")
 	}
 
-	return idString, nil
+	return claimsStruct, nil
 }
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+
+	// Test vectors from RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+	}
+
+	for _, c := range cases {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != c.expected {
+			t.Errorf("%v != %v", code, c.expected)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := TOTPCode(secret, TOTPStep(now.Add(-totpPeriod*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Codes from the previous step are accepted
+	step, ok := ValidateTOTP(secret, code, now)
+	if !ok || step != TOTPStep(now)-1 {
+		t.Errorf("Expecting code from previous step to be accepted")
+	}
+
+	// Codes from long ago are rejected
+	if _, ok := ValidateTOTP(secret, code, now.Add(5*time.Minute)); ok {
+		t.Errorf("Expecting old code to be rejected")
+	}
+}
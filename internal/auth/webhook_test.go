@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookVerifier(t *testing.T) {
+
+	now := time.Now()
+	verifier := NewWebhookVerifier([]string{"new-secret", "old-secret"}, 5*time.Minute, "X-Signature", "X-Timestamp")
+	verifier.now = func() time.Time { return now }
+
+	body := []byte(`{"event":"user.upgraded"}`)
+
+	newHeader := func(secret string, timestamp time.Time, body []byte) http.Header {
+		header := http.Header{}
+		header.Set("X-Signature", SignWebhook(secret, timestamp.Unix(), body))
+		header.Set("X-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+		return header
+	}
+
+	cases := []struct {
+		name     string
+		header   http.Header
+		body     []byte
+		expected error
+	}{
+		{name: "current secret", header: newHeader("new-secret", now, body), body: body, expected: nil},
+		{name: "rotated secret", header: newHeader("old-secret", now.Add(-time.Second), body), body: body, expected: nil},
+		{name: "replayed", header: newHeader("new-secret", now, body), body: body, expected: ErrWebhookReplayed},
+		{name: "replayed with other secret", header: newHeader("old-secret", now, body), body: body, expected: ErrWebhookReplayed},
+		{name: "unknown secret", header: newHeader("other-secret", now, body), body: body, expected: ErrWebhookSignatureInvalid},
+		{name: "tampered body", header: newHeader("new-secret", now.Add(-2*time.Second), body), body: []byte(`{"event":"user.downgraded"}`), expected: ErrWebhookSignatureInvalid},
+		{name: "too old", header: newHeader("new-secret", now.Add(-10*time.Minute), body), body: body, expected: ErrWebhookTimestampExpired},
+		{name: "missing", header: http.Header{}, body: body, expected: ErrWebhookSignatureMissing},
+	}
+
+	for _, c := range cases {
+		err := verifier.Verify(c.header, c.body)
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%s: %v != %v", c.name, err, c.expected)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package database
+
+import "errors"
+
+// Errors returned by DB methods, so callers can tell
+// a missing record from a failure reading the database.
+var (
+	// ErrNotFound is returned when no record matches.
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicateEmail is returned when another user has the email address.
+	ErrDuplicateEmail = errors.New("email address already in use")
+
+	// ErrDuplicateHandle is returned when another user has the handle.
+	ErrDuplicateHandle = errors.New("handle already in use")
+
+	// ErrForbidden is returned when a user changes a record belonging to another user.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrLoginLocked is returned when logins are locked after too many failures.
+	ErrLoginLocked = errors.New("login locked")
+
+	// ErrVersionConflict is returned when a record changed since the version the caller expects.
+	ErrVersionConflict = errors.New("version conflict")
+)
@@ -0,0 +1,16 @@
+package database
+
+import "github.com/ahgr3y/chirpy/internal/metrics"
+
+// dbDuration times reading and writing the database file,
+// including waiting for the lock.
+var dbDuration = metrics.NewHistogramVec(
+	"chirpy_db_operation_duration_seconds",
+	"Time taken to load or write the database file.",
+	metrics.DefaultBuckets,
+	"operation",
+)
+
+func init() {
+	metrics.Default.MustRegister(dbDuration)
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+type APIKey struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	KeyHash   string     `json:"key_hash"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the API key has passed its expiry.
+// Keys without an expiry never expire.
+func (key APIKey) Expired() bool {
+	return key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)
+}
+
+// HasScope reports whether the API key was granted scope.
+func (key APIKey) HasScope(scope string) bool {
+	return slices.Contains(key.Scopes, scope)
+}
+
+// CreateAPIKey saves an API key for user with userID to the database.
+// Only the hash of the key is stored.
+func (db *DB) CreateAPIKey(ctx context.Context, userID int, name string, prefix string, keyHash string, scopes []string, expiresAt *time.Time) (APIKey, error) {
+
+	var key APIKey
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Initialize APIKey.
+		key = APIKey{
+			ID:        nextID(dbStructure.LastIDs, "api_keys", dbStructure.APIKeys),
+			UserID:    userID,
+			Name:      name,
+			Prefix:    prefix,
+			KeyHash:   keyHash,
+			Scopes:    scopes,
+			CreatedAt: time.Now().UTC(),
+			ExpiresAt: expiresAt,
+		}
+
+		// Save API key to database.
+		dbStructure.APIKeys[key.ID] = key
+		return nil
+	})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// GetAPIKeysByUserID returns all API keys of user with userID in ascending order.
+func (db *DB) GetAPIKeysByUserID(ctx context.Context, userID int) ([]APIKey, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return []APIKey{}, err
+	}
+
+	keys := []APIKey{}
+	for _, key := range dbStructure.APIKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves the API key with keyHash.
+func (db *DB) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	for _, key := range dbStructure.APIKeys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+
+	return APIKey{}, ErrNotFound
+}
+
+// RevokeAPIKey deletes API key with keyID owned by user with userID.
+func (db *DB) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Ensure API key can only be revoked by owner.
+		key, exist := dbStructure.APIKeys[keyID]
+		if !exist {
+			return ErrNotFound
+		}
+		if key.UserID != userID {
+			return ErrForbidden
+		}
+
+		delete(dbStructure.APIKeys, keyID)
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	first, err := db.CreateAPIKey(ctx, 1, "bot", "chirpy_abc", "hash1", []string{"chirps:write"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.CreateAPIKey(ctx, 1, "old bot", "chirpy_def", "hash2", []string{"chirps:write"}, &expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := db.GetAPIKeyByHash(ctx, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != first.ID || key.Expired() || !key.HasScope("chirps:write") || key.HasScope("chirps:delete") {
+		t.Errorf("unexpected api key: %v", key)
+	}
+
+	key, err = db.GetAPIKeyByHash(ctx, "hash2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Expired() {
+		t.Errorf("Expecting api key %d to be expired", key.ID)
+	}
+
+	// Keys can only be revoked by their owner
+	if err := db.RevokeAPIKey(ctx, 2, first.ID); err == nil {
+		t.Error("Expecting error revoking another user's api key")
+	}
+	if err := db.RevokeAPIKey(ctx, 1, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetAPIKeyByHash(ctx, "hash1"); err == nil {
+		t.Error("Expecting revoked api key to be deleted")
+	}
+
+	// Ids are not reused after a revoke
+	third, err := db.CreateAPIKey(ctx, 1, "new bot", "chirpy_ghi", "hash3", []string{"chirps:delete"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID == second.ID {
+		t.Errorf("Expecting new id, got %d", third.ID)
+	}
+
+	keys, err := db.GetAPIKeysByUserID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expecting 2 api keys, got %d", len(keys))
+	}
+}
@@ -1,40 +1,65 @@
 package database
 
 import (
-	"errors"
-	"os"
+	"context"
 	"sort"
+	"time"
 )
 
 type Chirp struct {
-	AuthorID int    `json:"author_id"`
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
+	AuthorID  int        `json:"author_id"`
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	ReplyToID int        `json:"reply_to_id,omitempty"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	Scheduled bool       `json:"scheduled,omitempty"`
+	Version   int        `json:"version,omitempty"`
+}
+
+// Published reports whether the chirp is visible to everyone.
+// Scheduled chirps are only visible to their author until published.
+func (c Chirp) Published() bool {
+	return !c.Scheduled
 }
 
 // CreateChirp creates a Chirp using body
 // and saves it to the database.
-func (db *DB) CreateChirp(userID int, body string) (Chirp, error) {
+// If replyToID is not 0 the chirp replies to the chirp with replyToID.
+func (db *DB) CreateChirp(ctx context.Context, userID int, body string, replyToID int) (Chirp, error) {
+	return db.createChirp(ctx, userID, body, replyToID, nil)
+}
 
-	// Load database.
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return Chirp{}, err
-	}
+// ScheduleChirp creates a Chirp like CreateChirp that stays
+// unpublished until publishAt.
+func (db *DB) ScheduleChirp(ctx context.Context, userID int, body string, replyToID int, publishAt time.Time) (Chirp, error) {
+	publishAt = publishAt.UTC()
+	return db.createChirp(ctx, userID, body, replyToID, &publishAt)
+}
 
-	// Generate unique id for Chirp.
-	chirpID := len(dbStructure.Chirps) + 1
+func (db *DB) createChirp(ctx context.Context, userID int, body string, replyToID int, publishAt *time.Time) (Chirp, error) {
 
-	// Initialize Chirp.
-	chirp := Chirp{
-		AuthorID: userID,
-		ID:       chirpID,
-		Body:     body,
-	}
+	var chirp Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Ensure chirp replied to exists.
+		if parent, exist := dbStructure.Chirps[replyToID]; replyToID != 0 && (!exist || !parent.Published()) {
+			return ErrNotFound
+		}
+
+		// Initialize Chirp with a unique id.
+		chirp = Chirp{
+			AuthorID:  userID,
+			ID:        nextID(dbStructure.LastIDs, "chirps", dbStructure.Chirps),
+			Body:      body,
+			ReplyToID: replyToID,
+			PublishAt: publishAt,
+			Scheduled: publishAt != nil,
+		}
 
-	// Save chirp to database.
-	dbStructure.Chirps[chirpID] = chirp
-	err = db.writeDB(dbStructure)
+		// Save chirp to database.
+		chirp = dbStructure.putChirp(chirp)
+		return nil
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
@@ -43,10 +68,10 @@ func (db *DB) CreateChirp(userID int, body string) (Chirp, error) {
 }
 
 // GetChirps returns all chirps in the database.
-func (db *DB) GetChirps() ([]Chirp, error) {
+func (db *DB) GetChirps(ctx context.Context) ([]Chirp, error) {
 
 	// Load DBStructure
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return []Chirp{}, err
 	}
@@ -54,19 +79,21 @@ func (db *DB) GetChirps() ([]Chirp, error) {
 	// Empty slice to store Chirps
 	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
 
-	// Fill chirps with Chirps from dbStructure
+	// Fill chirps with published Chirps from dbStructure
 	for _, chirp := range dbStructure.Chirps {
-		chirps = append(chirps, chirp)
+		if chirp.Published() {
+			chirps = append(chirps, chirp)
+		}
 	}
 
 	return chirps, nil
 }
 
 // GetChirps returns all chirps created by user with userID in the database.
-func (db *DB) GetChirpsByID(userID int) ([]Chirp, error) {
+func (db *DB) GetChirpsByID(ctx context.Context, userID int) ([]Chirp, error) {
 
 	// Load DBStructure
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return []Chirp{}, err
 	}
@@ -76,7 +103,7 @@ func (db *DB) GetChirpsByID(userID int) ([]Chirp, error) {
 
 	// Fill chirps with Chirps from dbStructure
 	for _, chirp := range dbStructure.Chirps {
-		if chirp.AuthorID == userID {
+		if chirp.AuthorID == userID && chirp.Published() {
 			chirps = append(chirps, chirp)
 		}
 	}
@@ -85,63 +112,153 @@ func (db *DB) GetChirpsByID(userID int) ([]Chirp, error) {
 }
 
 // GetChirp retrieves a single Chirp by chirp ID.
-func (db *DB) GetChirp(chirpID int) (Chirp, error) {
+func (db *DB) GetChirp(ctx context.Context, chirpID int) (Chirp, error) {
 
 	// Retrieve dbStructure from database
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return Chirp{}, err
 	}
 
 	// Retrieve chirp from dbStructure
 	chirp, exist := dbStructure.Chirps[chirpID]
-	if !exist {
-		return Chirp{}, os.ErrNotExist
+	if !exist || !chirp.Published() {
+		return Chirp{}, ErrNotFound
 	}
 
 	return chirp, nil
 }
 
-// DeleteChirp deletes chirp with chirpID by user with userID.
-// Sorts the remaining chirps to prevent ID conflict by
-// future Chirps created.
-func (db *DB) DeleteChirp(userID int, chirpID int) error {
+// UpdateChirp replaces the body of chirp with chirpID by user with userID.
+// If version is not 0 the chirp must still be at version.
+func (db *DB) UpdateChirp(ctx context.Context, userID int, chirpID int, body string, version int) (Chirp, error) {
 
-	// Load database.
-	dbStructure, err := db.loadDB()
+	var chirp Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Ensure Chirp can only be edited by owner.
+		// Scheduled chirps don't exist for anyone else yet.
+		current, exist := dbStructure.Chirps[chirpID]
+		if !exist || (!current.Published() && current.AuthorID != userID) {
+			return ErrNotFound
+		}
+		if current.AuthorID != userID {
+			return ErrForbidden
+		}
+		if version != 0 && current.Version != version {
+			return ErrVersionConflict
+		}
+
+		current.Body = body
+		chirp = dbStructure.putChirp(current)
+		return nil
+	})
 	if err != nil {
-		return err
+		return Chirp{}, err
 	}
 
-	// Ensure Chirp can only be deleted by owner.
-	chirpToDelete, err := db.GetChirp(chirpID)
+	return chirp, nil
+}
+
+// DeleteChirp deletes chirp with chirpID by user with userID.
+func (db *DB) DeleteChirp(ctx context.Context, userID int, chirpID int) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Ensure Chirp can only be deleted by owner.
+		chirpToDelete, exist := dbStructure.Chirps[chirpID]
+		if !exist || !chirpToDelete.Published() {
+			return ErrNotFound
+		}
+		if chirpToDelete.AuthorID != userID {
+			return ErrForbidden
+		}
+
+		dbStructure.deleteChirp(chirpID)
+
+		// Remove likes of deleted chirp.
+		for key, like := range dbStructure.Likes {
+			if like.ChirpID == chirpID {
+				delete(dbStructure.Likes, key)
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetScheduledChirps returns the unpublished chirps of user with userID,
+// the next to be published first.
+func (db *DB) GetScheduledChirps(ctx context.Context, userID int) ([]Chirp, error) {
+
+	// Load DBStructure
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
-		return err
+		return []Chirp{}, err
 	}
-	if chirpToDelete.AuthorID != userID {
-		return errors.New("unauthorized to delete chirp")
+
+	chirps := []Chirp{}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.AuthorID == userID && !chirp.Published() {
+			chirps = append(chirps, chirp)
+		}
 	}
 
-	delete(dbStructure.Chirps, chirpID)
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].PublishAt.Before(*chirps[j].PublishAt)
+	})
+
+	return chirps, nil
+}
 
-	// Re-assign chirp id for remaining chirps in database.
-	db.ReassignChirpID(dbStructure.Chirps)
+// CancelScheduledChirp deletes the unpublished chirp with chirpID by user with userID.
+func (db *DB) CancelScheduledChirp(ctx context.Context, userID int, chirpID int) error {
 
-	// Update database.
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Only the author knows about an unpublished chirp.
+		chirp, exist := dbStructure.Chirps[chirpID]
+		if !exist || chirp.Published() || chirp.AuthorID != userID {
+			return ErrNotFound
+		}
 
-	return nil
+		dbStructure.deleteChirp(chirpID)
+		return nil
+	})
 }
 
-func (db *DB) ReassignChirpID(chirps map[int]Chirp) {
+// PublishDueChirps publishes every scheduled chirp due at now.
+// Returns the chirps published, oldest first.
+func (db *DB) PublishDueChirps(ctx context.Context, now time.Time) ([]Chirp, error) {
 
-	for i, chirp := range chirps {
-		chirp.ID = i + 1
+	published := []Chirp{}
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		for _, chirp := range dbStructure.Chirps {
+			if chirp.Published() || chirp.PublishAt.After(now) {
+				continue
+			}
+
+			chirp.Scheduled = false
+			chirp = dbStructure.putChirp(chirp)
+			published = append(published, chirp)
+		}
+
+		if len(published) == 0 {
+			return errUnchanged
+		}
+
+		return nil
+	})
+	if err != nil {
+		return []Chirp{}, err
 	}
 
+	sort.Slice(published, func(i, j int) bool {
+		return published[i].PublishAt.Before(*published[j].PublishAt)
+	})
+
+	return published, nil
 }
 
 // SortChirpByID sorts chirps in ascending order by ID.
@@ -162,3 +279,33 @@ func SortChirpsByID(chirps []Chirp, sortBy string) {
 	}
 
 }
+
+// ChirpsVersion returns a counter which changes whenever
+// a chirp is created, edited, published or deleted.
+func (db *DB) ChirpsVersion(ctx context.Context) (int, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return dbStructure.ChirpsVersion, nil
+}
+
+// putChirp saves chirp as its next version. Returns the saved chirp.
+func (dbStructure *DBStructure) putChirp(chirp Chirp) Chirp {
+
+	chirp.Version++
+	dbStructure.Chirps[chirp.ID] = chirp
+	dbStructure.ChirpsVersion++
+
+	return chirp
+}
+
+// deleteChirp deletes the chirp with chirpID.
+func (dbStructure *DBStructure) deleteChirp(chirpID int) {
+
+	delete(dbStructure.Chirps, chirpID)
+	dbStructure.ChirpsVersion++
+}
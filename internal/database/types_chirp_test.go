@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduleChirp(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	later, err := db.ScheduleChirp(ctx, 1, "later", 0, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	soon, err := db.ScheduleChirp(ctx, 1, "soon", 0, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scheduled chirps are hidden from everyone but their author
+	chirps, err := db.GetChirps(ctx)
+	if err != nil || len(chirps) != 0 {
+		t.Errorf("Expecting no published chirps, got %v: %v", chirps, err)
+	}
+	if _, err = db.GetChirp(ctx, soon.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expecting ErrNotFound, got %v", err)
+	}
+	if _, _, err = db.LikeChirp(ctx, 2, soon.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expecting ErrNotFound liking scheduled chirp, got %v", err)
+	}
+	if _, err = db.UpdateChirp(ctx, 2, soon.ID, "edited", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expecting ErrNotFound editing other's scheduled chirp, got %v", err)
+	}
+	scheduled, err := db.GetScheduledChirps(ctx, 1)
+	if err != nil || len(scheduled) != 2 || scheduled[0].ID != soon.ID {
+		t.Errorf("Expecting soonest scheduled chirp first, got %v: %v", scheduled, err)
+	}
+
+	// Only due chirps are published
+	published, err := db.PublishDueChirps(ctx, now.Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].ID != soon.ID || !published[0].Published() {
+		t.Fatalf("Expecting soon to be published, got %v", published)
+	}
+	if _, err = db.GetChirp(ctx, soon.ID); err != nil {
+		t.Errorf("Expecting published chirp to be visible: %v", err)
+	}
+
+	// Only the author can cancel, and only before publishing
+	if err = db.CancelScheduledChirp(ctx, 2, later.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expecting ErrNotFound cancelling other's chirp, got %v", err)
+	}
+	if err = db.CancelScheduledChirp(ctx, 1, soon.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expecting ErrNotFound cancelling published chirp, got %v", err)
+	}
+	err = db.CancelScheduledChirp(ctx, 1, later.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err = db.PublishDueChirps(ctx, now.Add(3*time.Hour))
+	if err != nil || len(published) != 0 {
+		t.Errorf("Expecting cancelled chirp not to be published, got %v: %v", published, err)
+	}
+}
+
+func TestChirpVersions(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chirp, err := db.CreateChirp(ctx, 1, "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirp.Version != 1 {
+		t.Errorf("Expecting new chirp at version 1, got %d", chirp.Version)
+	}
+
+	// Edits must be made to the current version
+	_, err = db.UpdateChirp(ctx, 1, chirp.ID, "stale", 2)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expecting ErrVersionConflict, got %v", err)
+	}
+	chirp, err = db.UpdateChirp(ctx, 1, chirp.ID, "edited", 1)
+	if err != nil || chirp.Version != 2 {
+		t.Errorf("Expecting chirp at version 2, got %v: %v", chirp, err)
+	}
+
+	// Every change to chirps changes the collection version
+	err = db.DeleteChirp(ctx, 1, chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := db.ChirpsVersion(ctx)
+	if err != nil || version != 3 {
+		t.Errorf("Expecting chirps version 3, got %d: %v", version, err)
+	}
+
+	// Ids of deleted chirps are not reused
+	next, err := db.CreateChirp(ctx, 1, "again", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == chirp.ID {
+		t.Errorf("Expecting new id, got %d", next.ID)
+	}
+}
@@ -1,10 +1,18 @@
 package database
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type DB struct {
@@ -12,10 +20,34 @@ type DB struct {
 	mux  *sync.RWMutex
 }
 
+var tracer = otel.Tracer("github.com/ahgr3y/chirpy/internal/database")
+
 type DBStructure struct {
 	Chirps        map[int]Chirp        `json:"chirps"`
 	Users         map[int]User         `json:"users"`
 	RefreshTokens map[int]RefreshToken `json:"refresh_tokens"`
+	APIKeys       map[int]APIKey       `json:"api_keys"`
+
+	EmailVerifications map[int]EmailVerification `json:"email_verifications"`
+	PasswordResets     map[int]PasswordReset     `json:"password_resets"`
+	RecoveryCodes      map[int]RecoveryCode      `json:"recovery_codes"`
+
+	LoginAttempts map[string]LoginAttempt `json:"login_attempts"`
+
+	SubscriptionEvents map[int]SubscriptionEvent   `json:"subscription_events"`
+	ProcessedWebhooks  map[string]ProcessedWebhook `json:"processed_webhooks"`
+
+	WebhookSubscriptions map[int]WebhookSubscription `json:"webhook_subscriptions"`
+	WebhookDeliveries    map[int]WebhookDelivery     `json:"webhook_deliveries"`
+
+	Likes         map[string]Like      `json:"likes"`
+	Notifications map[int]Notification `json:"notifications"`
+
+	// ChirpsVersion changes whenever any chirp does.
+	ChirpsVersion int `json:"chirps_version"`
+
+	// LastIDs holds the last id given out in each collection.
+	LastIDs map[string]int `json:"last_ids"`
 }
 
 // NewDB creates a new database connection
@@ -34,50 +66,124 @@ func NewDB(path string) (*DB, error) {
 	}
 
 	// Create database file if it doesn't exist
-	err := db.ensureDB()
+	err := db.ensureDB(context.Background())
 
 	return db, err
 }
 
 // createDB creates an empty dbStructure and writes it to disk
-func (db *DB) createDB() error {
+func (db *DB) createDB(ctx context.Context) error {
 
 	// Create an empty dbStructure
-	dbStructure := DBStructure{
-		Chirps:        make(map[int]Chirp),
-		Users:         make(map[int]User),
-		RefreshTokens: make(map[int]RefreshToken),
-	}
+	dbStructure := DBStructure{}
+	dbStructure.initMaps()
 
 	// Create a new database file
-	return db.writeDB(dbStructure)
+	return db.writeDB(ctx, dbStructure)
 }
 
 // ensureDB creates a new database file if it doesn't exist
-func (db *DB) ensureDB() error {
+func (db *DB) ensureDB(ctx context.Context) error {
 
 	// Check if database.json exist
 	_, err := os.ReadFile(db.path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			// Create a new database file
-			return db.createDB()
+			return db.createDB(ctx)
 		}
 	}
 
 	return err
 }
 
+// Ping checks the database file can be read and parsed.
+func (db *DB) Ping(ctx context.Context) error {
+	_, err := db.loadDB(ctx)
+	return err
+}
+
+// CheckWritable checks a file can be written next to the database file,
+// which fails when the disk is full or the directory is read-only.
+func (db *DB) CheckWritable(ctx context.Context) error {
+
+	file, err := os.CreateTemp(filepath.Dir(db.path), ".chirpy-health-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write([]byte("ok"))
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
 // loadDB reads the database file into memory
-func (db *DB) loadDB() (DBStructure, error) {
+func (db *DB) loadDB(ctx context.Context) (DBStructure, error) {
 
 	// Make database.json safe for reading
 	db.mux.RLock()
 	defer db.mux.RUnlock()
 
+	return db.readFile(ctx)
+}
+
+// writeDB writes the database file to disk
+func (db *DB) writeDB(ctx context.Context, dbStructure DBStructure) error {
+
+	// Make sure file is safe to read/write
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	return db.writeFile(ctx, dbStructure)
+}
+
+// update loads the database, lets modify change it and writes it back.
+// The write lock is held throughout, so concurrent updates can't overwrite
+// each other's changes or act on what another is changing. Nothing is
+// written if modify returns an error; errUnchanged makes update return nil.
+func (db *DB) update(ctx context.Context, modify func(dbStructure *DBStructure) error) error {
+
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	dbStructure, err := db.readFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = modify(&dbStructure)
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.writeFile(ctx, dbStructure)
+}
+
+// errUnchanged is returned by update callbacks that didn't change anything.
+var errUnchanged = errors.New("unchanged")
+
+// readFile reads the database file. Callers hold the lock.
+func (db *DB) readFile(ctx context.Context) (DBStructure, error) {
+
+	ctx, span := tracing.StartChild(ctx, tracer, "database.load")
+	defer span.End()
+
+	start := time.Now()
+	defer dbDuration.WithLabelValues("load").ObserveSince(start)
+
 	// Read database.json
 	data, err := os.ReadFile(db.path)
 	if errors.Is(err, os.ErrNotExist) {
+		slog.ErrorContext(ctx, "Error loading database", "path", db.path, "error", err)
+		tracing.RecordError(span, err)
 		return DBStructure{}, err
 	}
 
@@ -85,30 +191,117 @@ func (db *DB) loadDB() (DBStructure, error) {
 	dbStructure := DBStructure{}
 	err = json.Unmarshal(data, &dbStructure)
 	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing database", "path", db.path, "error", err)
+		tracing.RecordError(span, err)
 		return DBStructure{}, err
 	}
+	span.SetAttributes(attribute.Int("db.bytes", len(data)))
+	slog.DebugContext(ctx, "Loaded database", "bytes", len(data), "duration_ms", msSince(start))
+
+	// Database files written by older versions
+	// may be missing newer collections
+	dbStructure.initMaps()
 
 	return dbStructure, nil
 }
 
-// writeDB writes the database file to disk
-func (db *DB) writeDB(dbStructure DBStructure) error {
+// writeFile writes the database file. Callers hold the write lock.
+func (db *DB) writeFile(ctx context.Context, dbStructure DBStructure) error {
 
-	// Make sure file is safe to read/write
-	db.mux.Lock()
-	defer db.mux.Unlock()
+	ctx, span := tracing.StartChild(ctx, tracer, "database.write")
+	defer span.End()
+
+	start := time.Now()
+	defer dbDuration.WithLabelValues("write").ObserveSince(start)
 
 	// Parse dbStructure to JSON
 	dat, err := json.Marshal(dbStructure)
 	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding database", "error", err)
+		tracing.RecordError(span, err)
 		return err
 	}
 
 	// Write dat to path
 	err = os.WriteFile(db.path, dat, 0o600)
 	if err != nil {
+		slog.ErrorContext(ctx, "Error writing database", "path", db.path, "error", err)
+		tracing.RecordError(span, err)
 		return err
 	}
+	span.SetAttributes(attribute.Int("db.bytes", len(dat)))
+	slog.DebugContext(ctx, "Wrote database", "bytes", len(dat), "duration_ms", msSince(start))
 
 	return nil
 }
+
+// initMaps makes sure every collection in dbStructure can be written to
+func (dbStructure *DBStructure) initMaps() {
+
+	if dbStructure.Chirps == nil {
+		dbStructure.Chirps = make(map[int]Chirp)
+	}
+	if dbStructure.Users == nil {
+		dbStructure.Users = make(map[int]User)
+	}
+	if dbStructure.RefreshTokens == nil {
+		dbStructure.RefreshTokens = make(map[int]RefreshToken)
+	}
+	if dbStructure.APIKeys == nil {
+		dbStructure.APIKeys = make(map[int]APIKey)
+	}
+	if dbStructure.EmailVerifications == nil {
+		dbStructure.EmailVerifications = make(map[int]EmailVerification)
+	}
+	if dbStructure.PasswordResets == nil {
+		dbStructure.PasswordResets = make(map[int]PasswordReset)
+	}
+	if dbStructure.RecoveryCodes == nil {
+		dbStructure.RecoveryCodes = make(map[int]RecoveryCode)
+	}
+	if dbStructure.LoginAttempts == nil {
+		dbStructure.LoginAttempts = make(map[string]LoginAttempt)
+	}
+	if dbStructure.SubscriptionEvents == nil {
+		dbStructure.SubscriptionEvents = make(map[int]SubscriptionEvent)
+	}
+	if dbStructure.ProcessedWebhooks == nil {
+		dbStructure.ProcessedWebhooks = make(map[string]ProcessedWebhook)
+	}
+	if dbStructure.WebhookSubscriptions == nil {
+		dbStructure.WebhookSubscriptions = make(map[int]WebhookSubscription)
+	}
+	if dbStructure.WebhookDeliveries == nil {
+		dbStructure.WebhookDeliveries = make(map[int]WebhookDelivery)
+	}
+	if dbStructure.Likes == nil {
+		dbStructure.Likes = make(map[string]Like)
+	}
+	if dbStructure.Notifications == nil {
+		dbStructure.Notifications = make(map[int]Notification)
+	}
+	if dbStructure.LastIDs == nil {
+		dbStructure.LastIDs = make(map[string]int)
+	}
+}
+
+// msSince returns the milliseconds elapsed since start for log lines.
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// nextID returns a new id for collection m named collection. Ids only
+// go up, so an entry never gets the id of one deleted before it.
+// Files written before ids were counted start after the largest id in m.
+func nextID[T any](lastIDs map[string]int, collection string, m map[int]T) int {
+
+	lastID := lastIDs[collection]
+	for id := range m {
+		if id > lastID {
+			lastID = id
+		}
+	}
+
+	lastIDs[collection] = lastID + 1
+	return lastID + 1
+}
@@ -1,10 +1,17 @@
 package database
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 // Delete database.json before test
 func TestWriteGetChirps(t *testing.T) {
 
+	ctx := context.Background()
+
 	// Test NewDB and ensureDB
 	db, err := NewDB("../../database.json")
 	if err != nil {
@@ -12,7 +19,7 @@ func TestWriteGetChirps(t *testing.T) {
 	}
 
 	// Test GetChirps on empty db, and also test loadDB
-	chirps, err := db.GetChirps()
+	chirps, err := db.GetChirps(ctx)
 	if err != nil {
 		t.Error(err)
 	}
@@ -21,7 +28,7 @@ func TestWriteGetChirps(t *testing.T) {
 	}
 
 	// Load database.
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		t.Error(err)
 	}
@@ -37,13 +44,13 @@ func TestWriteGetChirps(t *testing.T) {
 
 	// Save chirp to database.
 	dbStructure.Chirps[chirpID] = chirp
-	err = db.writeDB(dbStructure)
+	err = db.writeDB(ctx, dbStructure)
 	if err != nil {
 		t.Error(err)
 	}
 
 	// Get Chirps from database
-	chirps, err = db.GetChirps()
+	chirps, err = db.GetChirps(ctx)
 	if err != nil {
 		t.Error(err)
 	}
@@ -60,3 +67,30 @@ func TestWriteGetChirps(t *testing.T) {
 	}
 
 }
+
+func TestPing(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Ping(ctx); err != nil {
+		t.Errorf("Expecting database to be readable, got %s", err)
+	}
+	if err := db.CheckWritable(ctx); err != nil {
+		t.Errorf("Expecting directory to be writable, got %s", err)
+	}
+
+	// A corrupted database file can't be parsed
+	err = os.WriteFile(path, []byte("{"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(ctx); err == nil {
+		t.Errorf("Expecting corrupted database to fail")
+	}
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Like is a user liking a chirp. A user likes a chirp at most once.
+type Like struct {
+	ChirpID   int       `json:"chirp_id"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func likeKey(chirpID int, userID int) string {
+	return strconv.Itoa(chirpID) + ":" + strconv.Itoa(userID)
+}
+
+// LikeChirp saves that user with userID likes chirp with chirpID.
+// Returns false if the user already liked the chirp.
+func (db *DB) LikeChirp(ctx context.Context, userID int, chirpID int) (Like, bool, error) {
+
+	var like Like
+	created := false
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		if chirp, exist := dbStructure.Chirps[chirpID]; !exist || !chirp.Published() {
+			return ErrNotFound
+		}
+
+		key := likeKey(chirpID, userID)
+		if existing, exist := dbStructure.Likes[key]; exist {
+			like = existing
+			return errUnchanged
+		}
+
+		like = Like{
+			ChirpID:   chirpID,
+			UserID:    userID,
+			CreatedAt: time.Now().UTC(),
+		}
+
+		// Save like to database.
+		dbStructure.Likes[key] = like
+		created = true
+		return nil
+	})
+	if err != nil {
+		return Like{}, false, err
+	}
+
+	return like, created, nil
+}
+
+// UnlikeChirp removes the like of user with userID from chirp with chirpID,
+// along with the notification it sent, so liking again notifies only once.
+func (db *DB) UnlikeChirp(ctx context.Context, userID int, chirpID int) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		key := likeKey(chirpID, userID)
+		if _, exist := dbStructure.Likes[key]; !exist {
+			return ErrNotFound
+		}
+		delete(dbStructure.Likes, key)
+
+		for id, notification := range dbStructure.Notifications {
+			if notification.Kind == NotificationLike && notification.ActorID == userID && notification.ChirpID == chirpID {
+				delete(dbStructure.Notifications, id)
+			}
+		}
+
+		return nil
+	})
+}
+
+// CountChirpLikes returns the number of users who like chirp with chirpID.
+func (db *DB) CountChirpLikes(ctx context.Context, chirpID int) (int, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, like := range dbStructure.Likes {
+		if like.ChirpID == chirpID {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLikeChirp(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = db.LikeChirp(ctx, 2, 1)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expecting ErrNotFound liking missing chirp, got %v", err)
+	}
+
+	chirp, err := db.CreateChirp(ctx, 1, "hello", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Liking twice counts once
+	_, created, err := db.LikeChirp(ctx, 2, chirp.ID)
+	if err != nil || !created {
+		t.Fatalf("Expecting like to be created: %v", err)
+	}
+	_, created, err = db.LikeChirp(ctx, 2, chirp.ID)
+	if err != nil || created {
+		t.Fatalf("Expecting existing like: %v", err)
+	}
+	_, _, err = db.LikeChirp(ctx, 3, chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := db.CountChirpLikes(ctx, chirp.ID); count != 2 {
+		t.Errorf("%v != 2", count)
+	}
+
+	// Unliking removes the notification the like sent
+	for _, actorID := range []int{2, 3} {
+		_, err = db.CreateNotification(ctx, 1, NotificationLike, actorID, chirp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.UnlikeChirp(ctx, 2, chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.UnlikeChirp(ctx, 2, chirp.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expecting ErrNotFound unliking twice, got %v", err)
+	}
+	notifications, err := db.GetNotifications(ctx, 1, 0, 10, false)
+	if err != nil || len(notifications) != 1 || notifications[0].ActorID != 3 {
+		t.Errorf("Expecting only the like of user 3 notified, got %v: %v", notifications, err)
+	}
+
+	// Deleting the chirp removes its likes
+	err = db.DeleteChirp(ctx, 1, chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := db.CountChirpLikes(ctx, chirp.ID); count != 0 {
+		t.Errorf("%v != 0", count)
+	}
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+)
+
+// LoginAttempt tracks failed logins for an account or a client IP.
+type LoginAttempt struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// ReserveLoginAttempt counts a login as failed under each key of policies,
+// before the credentials are checked, so parallel logins can't all pass the
+// lockout check. Call RefundLoginAttempt if the credentials turn out right.
+// If a key is locked nothing is counted and ErrLoginLocked is returned
+// with the time the lock ends.
+func (db *DB) ReserveLoginAttempt(ctx context.Context, policies map[string]auth.LockoutPolicy) (time.Time, error) {
+
+	var lockedUntil time.Time
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		now := time.Now().UTC()
+
+		// Forget failures that are no longer relevant.
+		resetAfter := time.Duration(0)
+		for _, policy := range policies {
+			resetAfter = max(resetAfter, policy.ResetAfter)
+		}
+		for k, attempt := range dbStructure.LoginAttempts {
+			if now.After(attempt.LockedUntil) && now.Sub(attempt.LastFailureAt) > resetAfter {
+				delete(dbStructure.LoginAttempts, k)
+			}
+		}
+
+		for key := range policies {
+			attempt := dbStructure.LoginAttempts[key]
+			if attempt.LockedUntil.After(now) && attempt.LockedUntil.After(lockedUntil) {
+				lockedUntil = attempt.LockedUntil
+			}
+		}
+		if !lockedUntil.IsZero() {
+			return ErrLoginLocked
+		}
+
+		for key, policy := range policies {
+			attempt := dbStructure.LoginAttempts[key]
+			attempt.Key = key
+			attempt.Failures++
+			attempt.LastFailureAt = now
+			attempt.LockedUntil = now.Add(policy.Backoff(attempt.Failures))
+			dbStructure.LoginAttempts[key] = attempt
+		}
+
+		return nil
+	})
+
+	return lockedUntil, err
+}
+
+// RefundLoginAttempt takes back a login counted as failed
+// by ReserveLoginAttempt under key.
+func (db *DB) RefundLoginAttempt(ctx context.Context, key string, policy auth.LockoutPolicy) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		attempt, exist := dbStructure.LoginAttempts[key]
+		if !exist {
+			return errUnchanged
+		}
+
+		attempt.Failures--
+		if attempt.Failures <= 0 {
+			delete(dbStructure.LoginAttempts, key)
+			return nil
+		}
+		attempt.LockedUntil = attempt.LastFailureAt.Add(policy.Backoff(attempt.Failures))
+		dbStructure.LoginAttempts[key] = attempt
+
+		return nil
+	})
+}
+
+// ClearLoginAttempts forgets the failed logins tracked under key.
+func (db *DB) ClearLoginAttempts(ctx context.Context, key string) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		if _, exist := dbStructure.LoginAttempts[key]; !exist {
+			return errUnchanged
+		}
+		delete(dbStructure.LoginAttempts, key)
+
+		return nil
+	})
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+)
+
+func TestReserveLoginAttempt(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := auth.LockoutPolicy{
+		Threshold:  3,
+		BaseDelay:  time.Minute,
+		MaxDelay:   time.Hour,
+		ResetAfter: time.Hour,
+	}
+	policies := map[string]auth.LockoutPolicy{"account:alice": policy}
+
+	// Parallel logins can't get more attempts than the threshold
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.ReserveLoginAttempt(ctx, policies)
+			if err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrLoginLocked) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != policy.Threshold {
+		t.Errorf("Expecting %d attempts allowed, got %d", policy.Threshold, allowed)
+	}
+
+	// Refunding an attempt lifts the lock
+	err = db.RefundLoginAttempt(ctx, "account:alice", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ReserveLoginAttempt(ctx, policies)
+	if err != nil {
+		t.Errorf("Expecting attempt after refund to be allowed, got %v", err)
+	}
+
+	// Clearing forgets every failure
+	err = db.ClearLoginAttempts(ctx, "account:alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockedUntil, err := db.ReserveLoginAttempt(ctx, policies)
+	if err != nil || !lockedUntil.IsZero() {
+		t.Errorf("Expecting attempt after clear to be allowed, got %v %v", lockedUntil, err)
+	}
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Kinds of notification.
+const (
+	NotificationReply   = "reply"
+	NotificationLike    = "like"
+	NotificationMention = "mention"
+	NotificationUpgrade = "upgrade"
+)
+
+// notificationRetention is how long notifications are kept, read or not.
+const notificationRetention = 90 * 24 * time.Hour
+
+// Notification tells a user something happened to them.
+// ActorID is the user who caused it and ChirpID the chirp
+// it is about, when there is one.
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Kind      string     `json:"kind"`
+	ActorID   int        `json:"actor_id,omitempty"`
+	ChirpID   int        `json:"chirp_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+// CreateNotification saves a notification of kind for user with userID.
+// Notifications older than the retention period are pruned.
+func (db *DB) CreateNotification(ctx context.Context, userID int, kind string, actorID int, chirpID int) (Notification, error) {
+
+	var notification Notification
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		now := time.Now().UTC()
+		pruneNotifications(*dbStructure, now)
+
+		notification = Notification{
+			ID:        nextID(dbStructure.LastIDs, "notifications", dbStructure.Notifications),
+			UserID:    userID,
+			Kind:      kind,
+			ActorID:   actorID,
+			ChirpID:   chirpID,
+			CreatedAt: now,
+		}
+
+		// Save notification to database.
+		dbStructure.Notifications[notification.ID] = notification
+		return nil
+	})
+	if err != nil {
+		return Notification{}, err
+	}
+
+	return notification, nil
+}
+
+// GetNotifications returns up to limit notifications of user with userID,
+// newest first. Pass the smallest id of the previous page as beforeID to
+// get the next page, or 0 for the first page.
+func (db *DB) GetNotifications(ctx context.Context, userID int, beforeID int, limit int, unreadOnly bool) ([]Notification, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return []Notification{}, err
+	}
+
+	cutoff := time.Now().Add(-notificationRetention)
+	notifications := []Notification{}
+	for _, notification := range dbStructure.Notifications {
+		if notification.UserID != userID || notification.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if beforeID != 0 && notification.ID >= beforeID {
+			continue
+		}
+		if unreadOnly && notification.ReadAt != nil {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].ID > notifications[j].ID
+	})
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+
+	return notifications, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications of user with userID.
+func (db *DB) CountUnreadNotifications(ctx context.Context, userID int) (int, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-notificationRetention)
+	count := 0
+	for _, notification := range dbStructure.Notifications {
+		if notification.UserID == userID && notification.ReadAt == nil && !notification.CreatedAt.Before(cutoff) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// MarkNotificationsRead marks the notifications with ids of user with userID
+// as read, or all of them when ids is empty.
+// Returns the number of notifications marked.
+func (db *DB) MarkNotificationsRead(ctx context.Context, userID int, ids []int) (int, error) {
+
+	marked := 0
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		now := time.Now().UTC()
+		for id, notification := range dbStructure.Notifications {
+			if notification.UserID != userID || notification.ReadAt != nil {
+				continue
+			}
+			if len(ids) > 0 && !slices.Contains(ids, id) {
+				continue
+			}
+
+			notification.ReadAt = &now
+			dbStructure.Notifications[id] = notification
+			marked++
+		}
+
+		if marked == 0 {
+			return errUnchanged
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return marked, nil
+}
+
+// pruneNotifications deletes notifications past retention at now.
+func pruneNotifications(dbStructure DBStructure, now time.Time) {
+	for id, notification := range dbStructure.Notifications {
+		if now.Sub(notification.CreatedAt) > notificationRetention {
+			delete(dbStructure.Notifications, id)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifications(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired notifications are hidden and pruned on the next write
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbStructure.Notifications[1] = Notification{ID: 1, UserID: 1, Kind: NotificationLike, CreatedAt: time.Now().Add(-notificationRetention - time.Hour)}
+	err = db.writeDB(ctx, dbStructure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err := db.CreateNotification(ctx, 1, NotificationLike, 2, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.CreateNotification(ctx, 2, NotificationUpgrade, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbStructure, err = db.loadDB(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dbStructure.Notifications) != 6 {
+		t.Errorf("Expecting expired notification to be pruned, got %d notifications", len(dbStructure.Notifications))
+	}
+
+	// Pages are newest first
+	page, err := db.GetNotifications(ctx, 1, 0, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 3 || page[0].ChirpID != 5 || page[2].ChirpID != 3 {
+		t.Fatalf("Unexpected first page: %+v", page)
+	}
+	page, err = db.GetNotifications(ctx, 1, page[2].ID, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].ChirpID != 2 {
+		t.Fatalf("Unexpected second page: %+v", page)
+	}
+
+	// Mark one, then the rest, as read
+	marked, err := db.MarkNotificationsRead(ctx, 1, []int{page[0].ID})
+	if err != nil || marked != 1 {
+		t.Fatalf("Expecting 1 marked read, got %d: %v", marked, err)
+	}
+	if unread, _ := db.CountUnreadNotifications(ctx, 1); unread != 4 {
+		t.Errorf("%v != 4", unread)
+	}
+	unreadPage, err := db.GetNotifications(ctx, 1, 0, 10, true)
+	if err != nil || len(unreadPage) != 4 {
+		t.Errorf("Expecting 4 unread notifications, got %d: %v", len(unreadPage), err)
+	}
+	marked, err = db.MarkNotificationsRead(ctx, 1, nil)
+	if err != nil || marked != 4 {
+		t.Fatalf("Expecting 4 marked read, got %d: %v", marked, err)
+	}
+
+	// Other users' notifications are untouched
+	if unread, _ := db.CountUnreadNotifications(ctx, 2); unread != 1 {
+		t.Errorf("%v != 1", unread)
+	}
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PasswordReset is a pending password reset of a user.
+// Each user has at most one, so requesting a new reset invalidates the old one.
+type PasswordReset struct {
+	UserID    int       `json:"user_id"`
+	TokenHash string    `json:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreatePasswordReset saves a pending password reset for user with userID,
+// replacing any previous one. Only the hash of the token is stored.
+func (db *DB) CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		dbStructure.PasswordResets[userID] = PasswordReset{
+			UserID:    userID,
+			TokenHash: tokenHash,
+			ExpiresAt: expiresAt,
+		}
+
+		return nil
+	})
+}
+
+// GetPasswordReset returns the password reset with tokenHash without using it up.
+// Returns an error if the reset doesn't exist or has expired.
+func (db *DB) GetPasswordReset(ctx context.Context, tokenHash string) (PasswordReset, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return PasswordReset{}, err
+	}
+
+	for _, reset := range dbStructure.PasswordResets {
+		if reset.TokenHash != tokenHash {
+			continue
+		}
+		if time.Now().After(reset.ExpiresAt) {
+			return PasswordReset{}, errPasswordResetExpired
+		}
+		return reset, nil
+	}
+
+	return PasswordReset{}, ErrNotFound
+}
+
+// ConsumePasswordReset deletes the password reset with tokenHash and sets
+// hashedPassword as the password of the user it belongs to, in one update
+// so a token can't be used twice. Returns the updated user.
+func (db *DB) ConsumePasswordReset(ctx context.Context, tokenHash string, hashedPassword string) (User, error) {
+
+	var user User
+	var resetErr error
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		for userID, reset := range dbStructure.PasswordResets {
+			if reset.TokenHash != tokenHash {
+				continue
+			}
+
+			// Tokens are single-use, even when expired
+			delete(dbStructure.PasswordResets, userID)
+			if time.Now().After(reset.ExpiresAt) {
+				resetErr = errPasswordResetExpired
+				return nil
+			}
+
+			current, exist := dbStructure.Users[reset.UserID]
+			if !exist {
+				return ErrNotFound
+			}
+			current.Password = hashedPassword
+			user = dbStructure.putUser(current)
+
+			return nil
+		}
+
+		return ErrNotFound
+	})
+	if err != nil {
+		return User{}, err
+	}
+	if resetErr != nil {
+		return User{}, resetErr
+	}
+
+	return user, nil
+}
+
+var errPasswordResetExpired = errors.New("password reset token expired")
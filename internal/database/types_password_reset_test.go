@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConsumePasswordReset(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, handle := range []string{"alice", "bob"} {
+		_, err = db.CreateUser(ctx, handle+"@example.com", handle, "old")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.CreatePasswordReset(ctx, 1, "hash1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreatePasswordReset(ctx, 2, "hash2", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Looking up a token doesn't use it up
+	reset, err := db.GetPasswordReset(ctx, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.UserID != 1 {
+		t.Errorf("%v != 1", reset.UserID)
+	}
+
+	user, err := db.ConsumePasswordReset(ctx, "hash1", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || user.Password != "new" {
+		t.Errorf("Expecting password of user 1 updated, got %+v", user)
+	}
+
+	// Tokens are single-use
+	if _, err := db.ConsumePasswordReset(ctx, "hash1", "other"); err == nil {
+		t.Error("Expecting used token to be rejected")
+	}
+	if _, err := db.GetPasswordReset(ctx, "hash1"); err == nil {
+		t.Error("Expecting used token to be gone")
+	}
+
+	// Expired tokens are rejected
+	if _, err := db.GetPasswordReset(ctx, "hash2"); err == nil {
+		t.Error("Expecting expired token to be rejected")
+	}
+	if _, err := db.ConsumePasswordReset(ctx, "hash2", "other"); err == nil {
+		t.Error("Expecting expired token to be rejected")
+	}
+	user, err = db.GetUser(ctx, 2)
+	if err != nil || user.Password != "old" {
+		t.Errorf("Expecting password of user 2 unchanged, got %+v %v", user, err)
+	}
+}
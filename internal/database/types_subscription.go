@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Subscription events sent by Polka.
+const (
+	EventUserUpgraded      = "user.upgraded"
+	EventUserDowngraded    = "user.downgraded"
+	EventUserCancelled     = "user.cancelled"
+	EventUserPaymentFailed = "user.payment_failed"
+)
+
+// Subscription statuses of a user.
+const (
+	SubscriptionActive     = "active"
+	SubscriptionPastDue    = "past_due"
+	SubscriptionDowngraded = "downgraded"
+	SubscriptionCancelled  = "cancelled"
+)
+
+// processedWebhookTTL is how long processed webhook ids are remembered.
+// Polka stops retrying deliveries well before then.
+const processedWebhookTTL = 30 * 24 * time.Hour
+
+// ErrUnknownSubscriptionEvent is returned for events that don't change subscriptions.
+var ErrUnknownSubscriptionEvent = errors.New("unknown subscription event")
+
+// SubscriptionEvent is an entry in a user's subscription history.
+type SubscriptionEvent struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	EventID    string    `json:"event_id,omitempty"`
+	Event      string    `json:"event"`
+	Status     string    `json:"status"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// ProcessedWebhook records a webhook delivery that was already handled.
+type ProcessedWebhook struct {
+	ID          string    `json:"id"`
+	Event       string    `json:"event"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// ApplySubscriptionEvent updates the subscription of user with userID.
+// Deliveries with an eventID that was already processed are ignored,
+// so retried webhooks don't apply twice.
+// Returns the updated user and whether the event was applied.
+func (db *DB) ApplySubscriptionEvent(ctx context.Context, eventID string, userID int, event string) (User, bool, error) {
+
+	switch event {
+	case EventUserUpgraded, EventUserPaymentFailed, EventUserDowngraded, EventUserCancelled:
+	default:
+		return User{}, false, ErrUnknownSubscriptionEvent
+	}
+
+	var user User
+	applied := false
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		current, exist := dbStructure.Users[userID]
+		if !exist {
+			return ErrNotFound
+		}
+		user = current
+
+		// Skip events that were already processed.
+		if _, processed := dbStructure.ProcessedWebhooks[eventID]; processed {
+			return errUnchanged
+		}
+
+		now := time.Now().UTC()
+
+		switch event {
+		case EventUserUpgraded:
+			if user.SubscriptionStatus != SubscriptionActive && user.SubscriptionStatus != SubscriptionPastDue {
+				user.SubscriptionStartedAt = now
+			}
+			user.IsChirpyRed = true
+			user.SubscriptionStatus = SubscriptionActive
+			user.SubscriptionEndedAt = time.Time{}
+		case EventUserPaymentFailed:
+			// Keep premium features while Polka retries the payment.
+			if !user.IsChirpyRed {
+				return errUnchanged
+			}
+			user.SubscriptionStatus = SubscriptionPastDue
+		case EventUserDowngraded:
+			user.IsChirpyRed = false
+			user.SubscriptionStatus = SubscriptionDowngraded
+			user.SubscriptionEndedAt = now
+		case EventUserCancelled:
+			user.IsChirpyRed = false
+			user.SubscriptionStatus = SubscriptionCancelled
+			user.SubscriptionEndedAt = now
+		}
+
+		user = dbStructure.putUser(user)
+
+		// Record event in subscription history.
+		id := nextID(dbStructure.LastIDs, "subscription_events", dbStructure.SubscriptionEvents)
+		dbStructure.SubscriptionEvents[id] = SubscriptionEvent{
+			ID:         id,
+			UserID:     userID,
+			EventID:    eventID,
+			Event:      event,
+			Status:     user.SubscriptionStatus,
+			OccurredAt: now,
+		}
+
+		// Remember the event, forgetting ones too old to be retried.
+		for id, processed := range dbStructure.ProcessedWebhooks {
+			if now.Sub(processed.ProcessedAt) > processedWebhookTTL {
+				delete(dbStructure.ProcessedWebhooks, id)
+			}
+		}
+		dbStructure.ProcessedWebhooks[eventID] = ProcessedWebhook{
+			ID:          eventID,
+			Event:       event,
+			ProcessedAt: now,
+		}
+
+		applied = true
+		return nil
+	})
+	if err != nil {
+		return User{}, false, err
+	}
+
+	return user, applied, nil
+}
+
+// GetSubscriptionEvents returns the subscription history of every user,
+// oldest first. Only events of user with userID are returned if userID isn't 0.
+func (db *DB) GetSubscriptionEvents(ctx context.Context, userID int) ([]SubscriptionEvent, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return []SubscriptionEvent{}, err
+	}
+
+	events := []SubscriptionEvent{}
+	for _, event := range dbStructure.SubscriptionEvents {
+		if userID == 0 || event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	return events, nil
+}
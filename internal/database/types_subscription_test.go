@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestApplySubscriptionEvent(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := db.CreateUser(ctx, "robin@onepiece.com", "robin", "ohara")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, applied, err := db.ApplySubscriptionEvent(ctx, "evt_1", user.ID, EventUserUpgraded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied || !user.IsChirpyRed || user.SubscriptionStatus != SubscriptionActive || user.SubscriptionStartedAt.IsZero() {
+		t.Errorf("unexpected user after upgrade: %+v", user)
+	}
+
+	// Profile and password updates keep the subscription
+	user, err = db.UpdateUserPassword(ctx, user.ID, "nico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = db.UpdateUserEmailPassword(ctx, user.ID, "nico@onepiece.com", "", "nico", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsChirpyRed || user.SubscriptionStatus != SubscriptionActive || user.Password != "nico" {
+		t.Errorf("unexpected user after update: %+v", user)
+	}
+
+	// Retried deliveries are ignored
+	_, applied, err = db.ApplySubscriptionEvent(ctx, "evt_1", user.ID, EventUserUpgraded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied {
+		t.Error("Expecting retried event to be ignored")
+	}
+
+	user, _, err = db.ApplySubscriptionEvent(ctx, "evt_2", user.ID, EventUserPaymentFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsChirpyRed || user.SubscriptionStatus != SubscriptionPastDue {
+		t.Errorf("unexpected user after failed payment: %+v", user)
+	}
+
+	user, _, err = db.ApplySubscriptionEvent(ctx, "evt_3", user.ID, EventUserCancelled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.IsChirpyRed || user.SubscriptionStatus != SubscriptionCancelled || user.SubscriptionEndedAt.IsZero() {
+		t.Errorf("unexpected user after cancellation: %+v", user)
+	}
+
+	if _, _, err := db.ApplySubscriptionEvent(ctx, "evt_4", user.ID, "user.renamed"); err != ErrUnknownSubscriptionEvent {
+		t.Errorf("Expecting ErrUnknownSubscriptionEvent, got %v", err)
+	}
+
+	events, err := db.GetSubscriptionEvents(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expecting 3 subscription events, got %d", len(events))
+	}
+	if events[0].Event != EventUserUpgraded || events[2].Status != SubscriptionCancelled {
+		t.Errorf("unexpected subscription history: %+v", events)
+	}
+
+	// Parallel deliveries of one event apply it once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	appliedCount := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, applied, err := db.ApplySubscriptionEvent(ctx, "evt_5", user.ID, EventUserUpgraded)
+			if err != nil {
+				t.Error(err)
+			}
+			if applied {
+				mu.Lock()
+				appliedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if appliedCount != 1 {
+		t.Errorf("Expecting event applied once, got %d", appliedCount)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
@@ -17,7 +18,7 @@ type RefreshToken struct {
 
 // CreateRefreshToken generates a refresh token
 // and stores it it database
-func (db *DB) CreateRefreshToken(id int) (RefreshToken, error) {
+func (db *DB) CreateRefreshToken(ctx context.Context, id int) (RefreshToken, error) {
 
 	// Generate a refresh token
 	token, err := GenerateRefreshToken(id)
@@ -26,7 +27,7 @@ func (db *DB) CreateRefreshToken(id int) (RefreshToken, error) {
 	}
 
 	// Save token to database
-	err = db.SaveTokenToDB(token)
+	err = db.SaveTokenToDB(ctx, token)
 	if err != nil {
 		return RefreshToken{}, err
 	}
@@ -57,32 +58,22 @@ func GenerateRefreshToken(id int) (RefreshToken, error) {
 	return token, nil
 }
 
-func (db *DB) SaveTokenToDB(token RefreshToken) error {
+func (db *DB) SaveTokenToDB(ctx context.Context, token RefreshToken) error {
 
-	// Load database
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
+	return db.update(ctx, func(dbStructure *DBStructure) error {
 
-	// Add/Update token to dbStructure
-	dbStructure.RefreshTokens[token.ID] = token
-
-	// Update database
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
-
-	return nil
+		// Add/Update token to dbStructure
+		dbStructure.RefreshTokens[token.ID] = token
+		return nil
+	})
 }
 
 // RenewJWT checks the validity of refreshToken.
 // If valid, returns a new JWT.
-func (db *DB) RenewJWT(refreshToken string, secretKey string) (string, error) {
+func (db *DB) RenewJWT(ctx context.Context, refreshToken string, secretKey string) (string, error) {
 
 	// Validate refreshToken.
-	id, err := db.validateRefreshToken(refreshToken)
+	id, err := db.validateRefreshToken(ctx, refreshToken)
 	if err != nil {
 		return "", err
 	}
@@ -99,10 +90,10 @@ func (db *DB) RenewJWT(refreshToken string, secretKey string) (string, error) {
 // validateRefreshToken looks up refreshToken in the database.
 // Returns an error message if it doesn't exist, or has expired.
 // Otherwise, return the user id of the user that corresponds to refreshToken.
-func (db *DB) validateRefreshToken(refreshToken string) (int, error) {
+func (db *DB) validateRefreshToken(ctx context.Context, refreshToken string) (int, error) {
 
 	// Load database.
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -135,27 +126,55 @@ func (db *DB) validateRefreshToken(refreshToken string) (int, error) {
 
 // RevokeRefreshToken revokes the RefreshToken associated with
 // refreshToken from the database.
-func (db *DB) RevokeRefreshToken(refreshToken string) error {
+func (db *DB) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Revoke the associated RefreshToken
+		dbTokens := dbStructure.RefreshTokens
+		for _, dbToken := range dbTokens {
+			if dbToken.Token == refreshToken {
+				delete(dbTokens, dbToken.ID)
+			}
+		}
+
+		return nil
+	})
+}
+
+// RevokeUserRefreshTokens revokes every RefreshToken of user with userID.
+func (db *DB) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Revoke the RefreshTokens belonging to user
+		for id, dbToken := range dbStructure.RefreshTokens {
+			if dbToken.ID == userID {
+				delete(dbStructure.RefreshTokens, id)
+			}
+		}
+
+		return nil
+	})
+}
+
+// CountActiveRefreshTokens returns the number of unexpired refresh tokens,
+// which is the number of signed in sessions.
+func (db *DB) CountActiveRefreshTokens(ctx context.Context) (int, error) {
 
 	// Load database.
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// Revoke the associated RefreshToken
-	dbTokens := dbStructure.RefreshTokens
-	for _, dbToken := range dbTokens {
-		if dbToken.Token == refreshToken {
-			delete(dbTokens, dbToken.ID)
+	now := time.Now()
+	count := 0
+	for _, token := range dbStructure.RefreshTokens {
+		if now.Before(token.ExpiresAt) {
+			count++
 		}
 	}
 
-	// Update database
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return count, nil
 }
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+// RecoveryCode lets a user finish a two-factor login without their authenticator.
+// Only the hash of the code is stored and it is deleted once used.
+type RecoveryCode struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"user_id"`
+	CodeHash string `json:"code_hash"`
+}
+
+// ErrTwoFactorEnabled is returned when enrolling a user who already uses two-factor authentication.
+var ErrTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+
+// SetPendingTOTPSecret saves secret for user with userID.
+// The secret isn't used for login until EnableTwoFactor is called.
+func (db *DB) SetPendingTOTPSecret(ctx context.Context, userID int, secret string) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		user, exist := dbStructure.Users[userID]
+		if !exist {
+			return ErrNotFound
+		}
+		if user.TwoFactorEnabled {
+			return ErrTwoFactorEnabled
+		}
+
+		user.TOTPSecret = secret
+		user.TOTPLastStep = 0
+		dbStructure.putUser(user)
+
+		return nil
+	})
+}
+
+// EnableTwoFactor turns on two-factor login for user with userID
+// and replaces their recovery codes with codeHashes.
+func (db *DB) EnableTwoFactor(ctx context.Context, userID int, codeHashes []string) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		user, exist := dbStructure.Users[userID]
+		if !exist {
+			return ErrNotFound
+		}
+		if user.TOTPSecret == "" {
+			return errors.New("two-factor enrollment not started")
+		}
+
+		user.TwoFactorEnabled = true
+		dbStructure.putUser(user)
+
+		// Replace recovery codes.
+		for id, code := range dbStructure.RecoveryCodes {
+			if code.UserID == userID {
+				delete(dbStructure.RecoveryCodes, id)
+			}
+		}
+		for _, codeHash := range codeHashes {
+			id := nextID(dbStructure.LastIDs, "recovery_codes", dbStructure.RecoveryCodes)
+			dbStructure.RecoveryCodes[id] = RecoveryCode{
+				ID:       id,
+				UserID:   userID,
+				CodeHash: codeHash,
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseTOTPStep records that user with userID logged in with the code
+// of time step, so the same code can't be replayed.
+func (db *DB) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		user, exist := dbStructure.Users[userID]
+		if !exist {
+			return ErrNotFound
+		}
+		if step <= user.TOTPLastStep {
+			return errors.New("totp code already used")
+		}
+
+		user.TOTPLastStep = step
+		dbStructure.putUser(user)
+
+		return nil
+	})
+}
+
+// ConsumeRecoveryCode deletes the recovery code with codeHash of user with userID.
+// Returns an error if user has no such recovery code.
+func (db *DB) ConsumeRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		for id, code := range dbStructure.RecoveryCodes {
+			if code.UserID == userID && code.CodeHash == codeHash {
+				delete(dbStructure.RecoveryCodes, id)
+				return nil
+			}
+		}
+
+		return ErrNotFound
+	})
+}
@@ -1,47 +1,64 @@
 package database
 
 import (
-	"errors"
-	"os"
+	"context"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ahgr3y/chirpy/internal/auth"
 )
 
 type User struct {
-	ID          int    `json:"id"`
-	Email       string `json:"email"`
-	Password    string `json:"password"`
-	IsChirpyRed bool   `json:"is_chirpy_red"`
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	Handle        string `json:"handle"`
+	Password      string `json:"password"`
+	IsChirpyRed   bool   `json:"is_chirpy_red"`
+	EmailVerified bool   `json:"email_verified"`
+
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	TOTPSecret       string `json:"totp_secret,omitempty"`
+	TOTPLastStep     int64  `json:"totp_last_step,omitempty"`
+
+	SubscriptionStatus    string    `json:"subscription_status,omitempty"`
+	SubscriptionStartedAt time.Time `json:"subscription_started_at"`
+	SubscriptionEndedAt   time.Time `json:"subscription_ended_at"`
+
+	Version int `json:"version"`
 }
 
-// CreateUser creates a User and saves it in the database
-func (db *DB) CreateUser(email string, password string) (User, error) {
+// CreateUser creates a User and saves it in the database.
+// handle is how other users mention the user, unique ignoring case.
+// Users without a handle can't be mentioned until they set one.
+func (db *DB) CreateUser(ctx context.Context, email string, handle string, password string) (User, error) {
 
-	// Load database
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
+	var user User
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
 
-	// Ensure no duplicate email
-	if isDuplicate := hasDuplicateEmail(dbStructure, email); isDuplicate {
-		return User{}, errors.New("cannot create user: duplicate email")
-	}
+		// Ensure no duplicate email
+		if isDuplicate := hasDuplicateEmail(*dbStructure, email); isDuplicate {
+			return ErrDuplicateEmail
+		}
 
-	// Get unique id of new User
-	id := len(dbStructure.Users) + 1
+		// Ensure no duplicate handle
+		if handle != "" && hasDuplicateHandle(*dbStructure, handle) {
+			return ErrDuplicateHandle
+		}
 
-	// Create a new User
-	user := User{
-		ID:          id,
-		Email:       email,
-		Password:    password,
-		IsChirpyRed: false,
-	}
+		// Create a new User with a unique id
+		user = User{
+			ID:          nextID(dbStructure.LastIDs, "users", dbStructure.Users),
+			Email:       email,
+			Handle:      handle,
+			Password:    password,
+			IsChirpyRed: false,
+		}
 
-	// Save user to database
-	dbStructure.Users[id] = user
-	err = db.writeDB(dbStructure)
+		// Save user to database
+		user = dbStructure.putUser(user)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -63,14 +80,23 @@ func hasDuplicateEmail(dbStructure DBStructure, email string) bool {
 	return false
 }
 
-// GetUser retrieves a single user by id
-func (db *DB) GetUser(id int) (User, error) {
+// hasDuplicateHandle checks the database for a user with handle, ignoring case
+func hasDuplicateHandle(dbStructure DBStructure, handle string) bool {
 
-	db.mux.RLock()
-	defer db.mux.RUnlock()
+	for _, user := range dbStructure.Users {
+		if strings.EqualFold(user.Handle, handle) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetUser retrieves a single user by id
+func (db *DB) GetUser(ctx context.Context, id int) (User, error) {
 
 	// Retrieve dbStructure from database
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return User{}, err
 	}
@@ -78,18 +104,60 @@ func (db *DB) GetUser(id int) (User, error) {
 	users := dbStructure.Users
 	user, exist := users[id]
 	if !exist {
-		return User{}, os.ErrNotExist
+		return User{}, ErrNotFound
 	}
 
 	return user, nil
 }
 
+// GetUserByEmail retrieves a single user by email
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (User, error) {
+
+	// Retrieve dbStructure from database
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return User{}, err
+	}
+
+	for _, user := range dbStructure.Users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+// GetUsers returns all users in the database.
+func (db *DB) GetUsers(ctx context.Context) ([]User, error) {
+
+	// Retrieve dbStructure from database
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return []User{}, err
+	}
+
+	users := make([]User, 0, len(dbStructure.Users))
+	for _, user := range dbStructure.Users {
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// dummyPasswordHash is compared against when no user matches the email,
+// so unknown emails take as long to reject as wrong passwords.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hashedPassword, _ := auth.HashPassword(context.Background(), "chirpy-dummy-password")
+	return hashedPassword
+})
+
 // AuthenticateUser compares given password and saved password
 // and return the User upon successful authentication
-func (db *DB) AuthenticateUser(email string, password string) (User, error) {
+func (db *DB) AuthenticateUser(ctx context.Context, email string, password string) (User, error) {
 
 	// Retrieve dbStructure from database
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return User{}, err
 	}
@@ -99,7 +167,7 @@ func (db *DB) AuthenticateUser(email string, password string) (User, error) {
 	for _, user := range users {
 		if user.Email == email {
 			// Check if password matches
-			err := auth.AuthenticatePassword(user.Password, password)
+			err := auth.AuthenticatePassword(ctx, user.Password, password)
 			if err != nil {
 				return User{}, err
 			}
@@ -108,29 +176,52 @@ func (db *DB) AuthenticateUser(email string, password string) (User, error) {
 		}
 	}
 
-	return User{}, os.ErrNotExist
+	// Spend the same time as checking a real password
+	auth.AuthenticatePassword(ctx, dummyPasswordHash(), password)
+
+	return User{}, ErrNotFound
 }
 
-// UpdateUser updates user's email and/or password
-func (db *DB) UpdateUserEmailPassword(id int, email string, password string, isChirpyRed bool) (User, error) {
+// UpdateUser updates user's email, handle and/or password.
+// Changing the email address requires it to be verified again.
+// An empty handle keeps the current one.
+// If version is not 0 the user must still be at version.
+// Subscription fields are kept as stored, they only change with Polka events.
+func (db *DB) UpdateUserEmailPassword(ctx context.Context, id int, email string, handle string, password string, version int) (User, error) {
 
-	// Updated user
-	user := User{
-		ID:          id,
-		Email:       email,
-		Password:    password,
-		IsChirpyRed: isChirpyRed,
-	}
+	var user User
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
 
-	// Retrieve database
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
-
-	// Upload user to database
-	dbStructure.Users[id] = user
-	err = db.writeDB(dbStructure)
+		// Updated user
+		current, exist := dbStructure.Users[id]
+		if !exist {
+			return ErrNotFound
+		}
+		if version != 0 && current.Version != version {
+			return ErrVersionConflict
+		}
+		if current.Email != email {
+			// Ensure no duplicate email
+			if hasDuplicateEmail(*dbStructure, email) {
+				return ErrDuplicateEmail
+			}
+			current.EmailVerified = false
+		}
+		if handle != "" && !strings.EqualFold(current.Handle, handle) {
+			// Ensure no duplicate handle
+			if hasDuplicateHandle(*dbStructure, handle) {
+				return ErrDuplicateHandle
+			}
+			current.Handle = handle
+		}
+		current.ID = id
+		current.Email = email
+		current.Password = password
+
+		// Upload user to database
+		user = dbStructure.putUser(current)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -139,48 +230,44 @@ func (db *DB) UpdateUserEmailPassword(id int, email string, password string, isC
 	return user, nil
 }
 
-func (db *DB) UpdateUserToDatabase(user User) error {
+// UpdateUserPassword replaces the password hash of user with id,
+// leaving everything else as stored.
+func (db *DB) UpdateUserPassword(ctx context.Context, id int, password string) (User, error) {
 
-	// Retrieve database
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
+	var user User
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
 
-	// Update user to database
-	dbStructure.Users[user.ID] = user
-	err = db.writeDB(dbStructure)
+		current, exist := dbStructure.Users[id]
+		if !exist {
+			return ErrNotFound
+		}
+		current.Password = password
+
+		user = dbStructure.putUser(current)
+		return nil
+	})
 	if err != nil {
-		return err
+		return User{}, err
 	}
 
-	return nil
+	return user, nil
 }
 
-// UpgradeUser promotes user with userID to a Chirpy Red user.
-func (db *DB) UpgradeUser(userID int) error {
+func (db *DB) UpdateUserToDatabase(ctx context.Context, user User) error {
 
-	// Load database.
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
+	return db.update(ctx, func(dbStructure *DBStructure) error {
 
-	// Retrieve user from database.
-	user, err := db.GetUser(userID)
-	if err != nil {
-		return err
-	}
+		// Update user to database
+		dbStructure.putUser(user)
+		return nil
+	})
+}
 
-	// Upgrade user to Chirpy Red status
-	user.IsChirpyRed = true
+// putUser saves user as its next version. Returns the saved user.
+func (dbStructure *DBStructure) putUser(user User) User {
 
-	// Update database.
+	user.Version++
 	dbStructure.Users[user.ID] = user
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
 
-	return nil
+	return user
 }
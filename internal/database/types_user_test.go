@@ -1,12 +1,16 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 )
 
 func TestCreateUser(t *testing.T) {
 
+	ctx := context.Background()
+
 	const databaseFilepath = "../../database.json"
 
 	db := DB{
@@ -14,12 +18,12 @@ func TestCreateUser(t *testing.T) {
 		mux:  &sync.RWMutex{},
 	}
 
-	user, err := db.CreateUser("luffy@onepiece.com", "ilovemeat") // id = 1
+	user, err := db.CreateUser(ctx, "luffy@onepiece.com", "luffy", "ilovemeat") // id = 1
 	if err != nil {
 		t.Error("Failed to create user")
 	}
 
-	dbStructure, err := db.loadDB()
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		t.Error("Failed to load database")
 	}
@@ -28,15 +32,22 @@ func TestCreateUser(t *testing.T) {
 		t.Errorf("%v != %v", dbStructure.Users[1], user)
 	}
 
-	_, err = db.CreateUser("luffy@onepiece.com", "ilovemeat")
-	if err == nil {
-		t.Error("Cannot create duplicate users")
+	_, err = db.CreateUser(ctx, "luffy@onepiece.com", "luffy", "ilovemeat")
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Expecting ErrDuplicateEmail creating duplicate users, got %v", err)
+	}
+
+	_, err = db.CreateUser(ctx, "monkey@onepiece.com", "Luffy", "ilovemeat")
+	if !errors.Is(err, ErrDuplicateHandle) {
+		t.Errorf("Expecting ErrDuplicateHandle creating users with the same handle, got %v", err)
 	}
 
 }
 
 func TestGetUser(t *testing.T) {
 
+	ctx := context.Background()
+
 	const databaseFilepath = "../../database.json"
 
 	db := DB{
@@ -44,12 +55,12 @@ func TestGetUser(t *testing.T) {
 		mux:  &sync.RWMutex{},
 	}
 
-	user, err := db.CreateUser("lane@bootdev.com", "password") // id = 2
+	user, err := db.CreateUser(ctx, "lane@bootdev.com", "lane", "password") // id = 2
 	if err != nil {
 		t.Error("Failed to create user")
 	}
 
-	userFromDB, err := db.GetUser(2)
+	userFromDB, err := db.GetUser(ctx, 2)
 	if err != nil {
 		t.Error("Failed to get user")
 	}
@@ -61,6 +72,8 @@ func TestGetUser(t *testing.T) {
 
 func TestUpdateUser(t *testing.T) {
 
+	ctx := context.Background()
+
 	const databaseFilepath = "../../database.json"
 
 	db := DB{
@@ -68,17 +81,17 @@ func TestUpdateUser(t *testing.T) {
 		mux:  &sync.RWMutex{},
 	}
 
-	_, err := db.CreateUser("harry@wizards.com", "ilovevoldemort") // id = 3
+	_, err := db.CreateUser(ctx, "harry@wizards.com", "harry", "ilovevoldemort") // id = 3
 	if err != nil {
 		t.Error("Failed to create user")
 	}
 
-	user, err := db.UpdateUserEmailPassword(3, "ron@wizards.com", "iloveclowns", false)
+	user, err := db.UpdateUserEmailPassword(ctx, 3, "ron@wizards.com", "ron", "iloveclowns", 0)
 	if err != nil {
 		t.Error("Failed to update user")
 	}
 
-	dbUser, err := db.GetUser(3)
+	dbUser, err := db.GetUser(ctx, 3)
 	if err != nil {
 		t.Error("Failed to get user")
 	}
@@ -87,4 +100,9 @@ func TestUpdateUser(t *testing.T) {
 		t.Errorf("%v != %v", user, dbUser)
 	}
 
+	_, err = db.UpdateUserEmailPassword(ctx, 3, "ron@wizards.com", "Luffy", "iloveclowns", 0)
+	if !errors.Is(err, ErrDuplicateHandle) {
+		t.Errorf("Expecting ErrDuplicateHandle taking another user's handle, got %v", err)
+	}
+
 }
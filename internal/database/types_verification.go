@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+// EmailVerification is the pending verification of a user's email address.
+// Each user has at most one, so issuing a new token invalidates the old one.
+type EmailVerification struct {
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email"`
+	TokenID string `json:"token_id"`
+}
+
+// CreateEmailVerification saves a pending verification of email
+// for user with userID, replacing any previous one.
+func (db *DB) CreateEmailVerification(ctx context.Context, userID int, email string, tokenID string) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		dbStructure.EmailVerifications[userID] = EmailVerification{
+			UserID:  userID,
+			Email:   email,
+			TokenID: tokenID,
+		}
+
+		return nil
+	})
+}
+
+// VerifyEmail marks the email of user with userID as verified
+// if tokenID matches the pending verification.
+// The pending verification is consumed so each token works once.
+func (db *DB) VerifyEmail(ctx context.Context, userID int, tokenID string) (User, error) {
+
+	var user User
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		// Retrieve user and pending verification.
+		current, exist := dbStructure.Users[userID]
+		if !exist {
+			return ErrNotFound
+		}
+		verification, exist := dbStructure.EmailVerifications[userID]
+		if !exist || verification.TokenID != tokenID {
+			return errors.New("verification token already used or replaced")
+		}
+
+		// Token was issued for an email the user no longer has.
+		if verification.Email != current.Email {
+			return errors.New("email changed since verification token was issued")
+		}
+
+		current.EmailVerified = true
+		user = dbStructure.putUser(current)
+		delete(dbStructure.EmailVerifications, userID)
+
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyEmail(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := db.CreateUser(ctx, "zoro@onepiece.com", "zoro", "swords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.EmailVerified {
+		t.Error("Expecting new user to be unverified")
+	}
+
+	err = db.CreateEmailVerification(ctx, user.ID, user.Email, "token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaced tokens no longer work
+	err = db.CreateEmailVerification(ctx, user.ID, user.Email, "token-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.VerifyEmail(ctx, user.ID, "token-1"); err == nil {
+		t.Error("Expecting replaced token to be rejected")
+	}
+
+	verified, err := db.VerifyEmail(ctx, user.ID, "token-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.EmailVerified {
+		t.Error("Expecting user to be verified")
+	}
+
+	// Tokens are single-use
+	if _, err := db.VerifyEmail(ctx, user.ID, "token-2"); err == nil {
+		t.Error("Expecting used token to be rejected")
+	}
+
+	// Changing email requires verifying again
+	updated, err := db.UpdateUserEmailPassword(ctx, user.ID, "zoro@strawhats.com", "", "swords", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.EmailVerified {
+		t.Error("Expecting changed email to be unverified")
+	}
+}
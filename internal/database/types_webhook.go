@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Statuses of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// webhookDeliveryRetention is how long finished deliveries are kept as logs.
+const webhookDeliveryRetention = 7 * 24 * time.Hour
+
+// WebhookSubscription is an endpoint that receives events from the server.
+// An empty Events receives every event.
+type WebhookSubscription struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the subscription receives events of eventType.
+func (sub WebhookSubscription) Wants(eventType string) bool {
+	return len(sub.Events) == 0 || slices.Contains(sub.Events, eventType)
+}
+
+// WebhookDelivery is an event queued for delivery to a subscription
+// together with the log of every attempt to deliver it.
+type WebhookDelivery struct {
+	ID             int              `json:"id"`
+	SubscriptionID int              `json:"subscription_id"`
+	EventID        string           `json:"event_id"`
+	EventType      string           `json:"event_type"`
+	Payload        string           `json:"payload"`
+	Status         string           `json:"status"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+	Attempts       []WebhookAttempt `json:"attempts"`
+}
+
+// WebhookAttempt is the outcome of one attempt to deliver a webhook.
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+}
+
+// CreateWebhookSubscription saves a subscription of url to events.
+func (db *DB) CreateWebhookSubscription(ctx context.Context, url string, events []string, secret string) (WebhookSubscription, error) {
+
+	var sub WebhookSubscription
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		sub = WebhookSubscription{
+			ID:        nextID(dbStructure.LastIDs, "webhook_subscriptions", dbStructure.WebhookSubscriptions),
+			URL:       url,
+			Events:    events,
+			Secret:    secret,
+			CreatedAt: time.Now().UTC(),
+		}
+
+		// Save subscription to database.
+		dbStructure.WebhookSubscriptions[sub.ID] = sub
+		return nil
+	})
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	return sub, nil
+}
+
+// GetWebhookSubscriptions returns all webhook subscriptions in ascending order.
+func (db *DB) GetWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return []WebhookSubscription{}, err
+	}
+
+	subs := make([]WebhookSubscription, 0, len(dbStructure.WebhookSubscriptions))
+	for _, sub := range dbStructure.WebhookSubscriptions {
+		subs = append(subs, sub)
+	}
+
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+
+	return subs, nil
+}
+
+// GetWebhookSubscription retrieves a single webhook subscription by id.
+func (db *DB) GetWebhookSubscription(ctx context.Context, id int) (WebhookSubscription, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	sub, exist := dbStructure.WebhookSubscriptions[id]
+	if !exist {
+		return WebhookSubscription{}, ErrNotFound
+	}
+
+	return sub, nil
+}
+
+// DeleteWebhookSubscription deletes the webhook subscription with id
+// together with its deliveries.
+func (db *DB) DeleteWebhookSubscription(ctx context.Context, id int) error {
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+
+		if _, exist := dbStructure.WebhookSubscriptions[id]; !exist {
+			return ErrNotFound
+		}
+		delete(dbStructure.WebhookSubscriptions, id)
+
+		for deliveryID, delivery := range dbStructure.WebhookDeliveries {
+			if delivery.SubscriptionID == id {
+				delete(dbStructure.WebhookDeliveries, deliveryID)
+			}
+		}
+
+		return nil
+	})
+}
+
+// EnqueueWebhookDeliveries queues the event with eventID for every
+// subscription that wants eventType. payload is the JSON body to send.
+// Returns the number of deliveries queued.
+func (db *DB) EnqueueWebhookDeliveries(ctx context.Context, eventID string, eventType string, payload string) (int, error) {
+
+	queued := 0
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		now := time.Now().UTC()
+
+		// Forget finished deliveries past retention.
+		for id, delivery := range dbStructure.WebhookDeliveries {
+			if delivery.Status != DeliveryPending && now.Sub(delivery.CreatedAt) > webhookDeliveryRetention {
+				delete(dbStructure.WebhookDeliveries, id)
+			}
+		}
+
+		for _, sub := range dbStructure.WebhookSubscriptions {
+			if !sub.Wants(eventType) {
+				continue
+			}
+
+			id := nextID(dbStructure.LastIDs, "webhook_deliveries", dbStructure.WebhookDeliveries)
+			dbStructure.WebhookDeliveries[id] = WebhookDelivery{
+				ID:             id,
+				SubscriptionID: sub.ID,
+				EventID:        eventID,
+				EventType:      eventType,
+				Payload:        payload,
+				Status:         DeliveryPending,
+				NextAttemptAt:  now,
+				CreatedAt:      now,
+				Attempts:       []WebhookAttempt{},
+			}
+			queued++
+		}
+
+		if queued == 0 {
+			return errUnchanged
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return queued, nil
+}
+
+// GetDueWebhookDeliveries returns pending deliveries due at now, oldest first.
+func (db *DB) GetDueWebhookDeliveries(ctx context.Context, now time.Time) ([]WebhookDelivery, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return []WebhookDelivery{}, err
+	}
+
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range dbStructure.WebhookDeliveries {
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID < deliveries[j].ID
+	})
+
+	return deliveries, nil
+}
+
+// GetWebhookDeliveries returns the deliveries of subscription with subscriptionID, newest first.
+func (db *DB) GetWebhookDeliveries(ctx context.Context, subscriptionID int) ([]WebhookDelivery, error) {
+
+	// Load database.
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return []WebhookDelivery{}, err
+	}
+
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range dbStructure.WebhookDeliveries {
+		if delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID > deliveries[j].ID
+	})
+
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt appends attempt to the log of delivery with id
+// and moves it to status. Pending deliveries are retried at nextAttemptAt.
+func (db *DB) RecordWebhookAttempt(ctx context.Context, id int, attempt WebhookAttempt, status string, nextAttemptAt time.Time) (WebhookDelivery, error) {
+
+	var delivery WebhookDelivery
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+
+		current, exist := dbStructure.WebhookDeliveries[id]
+		if !exist {
+			return ErrNotFound
+		}
+
+		current.Attempts = append(current.Attempts, attempt)
+		current.Status = status
+		current.NextAttemptAt = nextAttemptAt
+		dbStructure.WebhookDeliveries[id] = current
+		delivery = current
+
+		return nil
+	})
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
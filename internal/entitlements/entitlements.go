@@ -0,0 +1,53 @@
+package entitlements
+
+import "github.com/ahgr3y/chirpy/internal/database"
+
+// Tier is the plan a user is on.
+type Tier string
+
+const (
+	TierFree Tier = "free"
+	TierRed  Tier = "chirpy_red"
+)
+
+// Entitlements is what a user is allowed to do on their tier.
+// Handlers check these instead of the user's subscription status.
+type Entitlements struct {
+	Tier              Tier `json:"tier"`
+	MaxChirpLength    int  `json:"max_chirp_length"`
+	EditChirps        bool `json:"edit_chirps"`
+	ScheduleChirps    bool `json:"schedule_chirps"`
+	PremiumRateLimits bool `json:"premium_rate_limits"`
+}
+
+var tiers = map[Tier]Entitlements{
+	TierFree: {
+		Tier:           TierFree,
+		MaxChirpLength: 140,
+	},
+	TierRed: {
+		Tier:              TierRed,
+		MaxChirpLength:    280,
+		EditChirps:        true,
+		ScheduleChirps:    true,
+		PremiumRateLimits: true,
+	},
+}
+
+// ForTier returns the entitlements of tier.
+func ForTier(tier Tier) Entitlements {
+	return tiers[tier]
+}
+
+// TierOf returns the tier user is on.
+func TierOf(user database.User) Tier {
+	if user.IsChirpyRed {
+		return TierRed
+	}
+	return TierFree
+}
+
+// ForUser returns the entitlements of user.
+func ForUser(user database.User) Entitlements {
+	return ForTier(TierOf(user))
+}
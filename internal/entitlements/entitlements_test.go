@@ -0,0 +1,20 @@
+package entitlements
+
+import (
+	"testing"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+func TestForUser(t *testing.T) {
+
+	free := ForUser(database.User{ID: 1})
+	if free.Tier != TierFree || free.MaxChirpLength != 140 || free.EditChirps || free.ScheduleChirps || free.PremiumRateLimits {
+		t.Errorf("unexpected free entitlements: %+v", free)
+	}
+
+	red := ForUser(database.User{ID: 2, IsChirpyRed: true})
+	if red.Tier != TierRed || red.MaxChirpLength <= free.MaxChirpLength || !red.EditChirps || !red.ScheduleChirps || !red.PremiumRateLimits {
+		t.Errorf("unexpected chirpy red entitlements: %+v", red)
+	}
+}
@@ -0,0 +1,200 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event types published by the server.
+// User events mirror the subscription events received from Polka.
+const (
+	ChirpCreated      = "chirp.created"
+	ChirpDeleted      = "chirp.deleted"
+	ChirpLiked        = "chirp.liked"
+	UserUpgraded      = "user.upgraded"
+	UserDowngraded    = "user.downgraded"
+	UserCancelled     = "user.cancelled"
+	UserPaymentFailed = "user.payment_failed"
+)
+
+// Types lists every event type published by the server.
+var Types = []string{
+	ChirpCreated,
+	ChirpDeleted,
+	ChirpLiked,
+	UserUpgraded,
+	UserDowngraded,
+	UserCancelled,
+	UserPaymentFailed,
+}
+
+// Event is something that happened in the server.
+// Seq increases with every event published on a Bus
+// so subscribers can tell which events they missed.
+type Event struct {
+	ID         string    `json:"id"`
+	Seq        uint64    `json:"-"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// historySize is the number of recent events a Bus keeps
+// so subscribers can catch up on events they missed.
+const historySize = 256
+
+// Bus fans published events out to every subscription.
+// Publishing never blocks: a subscription that falls behind
+// by more than its buffer is closed.
+type Bus struct {
+	mu      sync.Mutex
+	seq     uint64
+	subs    map[*Subscription]struct{}
+	history []Event
+	closed  bool
+}
+
+// Subscription receives events published on a Bus.
+type Subscription struct {
+	bus *Bus
+	ch  chan Event
+}
+
+// NewBus creates a Bus without subscriptions.
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends an event of eventType with data to every subscription.
+func (b *Bus) Publish(eventType string, data any) Event {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := Event{
+		ID:         newEventID(),
+		Seq:        b.seq,
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+
+	// Remember recent events, oldest are forgotten first
+	if len(b.history) == historySize {
+		b.history = b.history[1:]
+	}
+	b.history = append(b.history, event)
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			// Drop slow subscribers instead of blocking the publisher
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+
+	return event
+}
+
+// Subscribe creates a subscription buffering up to buffer events.
+// Subscriptions to a closed Bus are closed straight away.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe(buffer)
+}
+
+// SubscribeSince creates a subscription like Subscribe and returns
+// the recent events published after the event with seq, so nothing
+// is missed between the two. If seq is newer than any event,
+// the Bus was restarted and every recent event is returned.
+func (b *Bus) SubscribeSince(seq uint64, buffer int) (*Subscription, []Event) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if seq > b.seq {
+		seq = 0
+	}
+
+	missed := []Event{}
+	for _, event := range b.history {
+		if event.Seq > seq {
+			missed = append(missed, event)
+		}
+	}
+
+	return b.subscribe(buffer), missed
+}
+
+func (b *Bus) subscribe(buffer int) *Subscription {
+
+	sub := &Subscription{
+		bus: b,
+		ch:  make(chan Event, buffer),
+	}
+
+	if b.closed {
+		close(sub.ch)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Close closes every subscription and stops accepting new ones,
+// letting subscribers finish when the server shuts down.
+func (b *Bus) Close() {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Closed reports whether the Bus was closed.
+func (b *Bus) Closed() bool {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+// Events returns the channel events are delivered on.
+// The channel is closed when the subscription is closed or falls behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close stops delivery of events to the subscription.
+func (s *Subscription) Close() {
+
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, exist := s.bus.subs[s]; exist {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
+
+func newEventID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return "evt_" + hex.EncodeToString(bytes)
+}
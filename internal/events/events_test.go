@@ -0,0 +1,80 @@
+package events
+
+import "testing"
+
+func TestBus(t *testing.T) {
+
+	bus := NewBus()
+	fast := bus.Subscribe(10)
+	slow := bus.Subscribe(1)
+
+	first := bus.Publish(ChirpCreated, 1)
+	second := bus.Publish(ChirpDeleted, 2)
+	if second.Seq != first.Seq+1 || first.ID == second.ID {
+		t.Errorf("Expecting increasing sequence and unique ids: %+v %+v", first, second)
+	}
+
+	// Fast subscriber receives every event in order
+	for _, expected := range []Event{first, second} {
+		event := <-fast.Events()
+		if event.ID != expected.ID {
+			t.Errorf("%v != %v", event.ID, expected.ID)
+		}
+	}
+
+	// Slow subscriber is dropped once its buffer is full
+	if event := <-slow.Events(); event.ID != first.ID {
+		t.Errorf("%v != %v", event.ID, first.ID)
+	}
+	if _, open := <-slow.Events(); open {
+		t.Error("Expecting slow subscription to be closed")
+	}
+
+	fast.Close()
+	fast.Close()
+	bus.Publish(ChirpCreated, 3)
+	if _, open := <-fast.Events(); open {
+		t.Error("Expecting closed subscription to receive nothing")
+	}
+}
+
+func TestBusSubscribeSince(t *testing.T) {
+
+	bus := NewBus()
+	for i := 0; i < historySize+10; i++ {
+		bus.Publish(ChirpCreated, i)
+	}
+
+	// Events after seq are replayed
+	sub, missed := bus.SubscribeSince(historySize+7, 10)
+	if len(missed) != 3 || missed[0].Seq != historySize+8 {
+		t.Errorf("Expecting 3 missed events from %d, got %+v", historySize+8, missed)
+	}
+
+	// Only recent events are kept
+	_, missed = bus.SubscribeSince(0, 10)
+	if len(missed) != historySize || missed[0].Seq != 11 {
+		t.Errorf("Expecting %d missed events from 11, got %d", historySize, len(missed))
+	}
+
+	// Unknown seq after a restart replays everything kept
+	_, missed = bus.SubscribeSince(10000, 10)
+	if len(missed) != historySize {
+		t.Errorf("Expecting %d missed events, got %d", historySize, len(missed))
+	}
+
+	// Subscription receives new events
+	event := bus.Publish(ChirpDeleted, nil)
+	if received := <-sub.Events(); received.ID != event.ID {
+		t.Errorf("%v != %v", received.ID, event.ID)
+	}
+
+	// Closing the bus closes every subscription, current and future
+	bus.Close()
+	if _, open := <-sub.Events(); open {
+		t.Error("Expecting subscription to be closed")
+	}
+	if _, open := <-bus.Subscribe(1).Events(); open {
+		t.Error("Expecting subscription to closed bus to be closed")
+	}
+}
@@ -0,0 +1,153 @@
+// Package health runs the checks deciding whether the server
+// is ready to handle requests.
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check statuses.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusShutdown    = "shutting_down"
+)
+
+// DefaultTimeout is used for checks registered without a timeout.
+const DefaultTimeout = 2 * time.Second
+
+// CheckFunc returns an error if what it checks is not ready.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the outcome of every check.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs the registered checks. It reports not ready
+// without running them once Shutdown is called.
+type Checker struct {
+	mu     sync.RWMutex
+	checks []check
+
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a Checker without checks.
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Register adds a check called name that fails if fn does
+// not return within timeout, DefaultTimeout if timeout is 0.
+func (c *Checker) Register(name string, timeout time.Duration, fn CheckFunc) {
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn})
+}
+
+// Shutdown makes the Checker report not ready from now on,
+// so load balancers stop sending requests while the server drains.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Run runs every check at the same time and reports the results
+// in the order of the check names.
+func (c *Checker) Run(ctx context.Context) Report {
+
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusShutdown, Checks: []CheckResult{}}
+	}
+
+	c.mu.RLock()
+	checks := append([]check{}, c.checks...)
+	c.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, chk)
+		}(i, chk)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	return report
+}
+
+// runCheck runs chk, giving up on it after its timeout.
+// Checks that ignore ctx are left to finish in the background.
+func runCheck(ctx context.Context, chk check) CheckResult {
+
+	ctx, cancel := context.WithTimeout(ctx, chk.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- chk.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.New("timed out after " + chk.timeout.String())
+	}
+
+	result := CheckResult{
+		Name:       chk.name,
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+
+	return result
+}
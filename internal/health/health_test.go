@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+
+	checker := NewChecker()
+	checker.Register("database", 0, func(ctx context.Context) error {
+		return nil
+	})
+
+	report := checker.Run(context.Background())
+	if !report.Ready() || len(report.Checks) != 1 || report.Checks[0].Status != StatusOK {
+		t.Fatalf("Expecting ready, got %+v", report)
+	}
+
+	// Failing and slow checks make the server unavailable
+	checker.Register("config", 0, func(ctx context.Context) error {
+		return errors.New("JWT_SECRET is not set")
+	})
+	checker.Register("disk", 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report = checker.Run(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expecting slow check to time out, took %s", time.Since(start))
+	}
+	if report.Ready() || report.Status != StatusUnavailable {
+		t.Fatalf("Expecting unavailable, got %+v", report)
+	}
+
+	want := map[string]string{
+		"config":   "JWT_SECRET is not set",
+		"database": "",
+		"disk":     "timed out after 10ms",
+	}
+	for i, name := range []string{"config", "database", "disk"} {
+		result := report.Checks[i]
+		if result.Name != name || result.Error != want[name] {
+			t.Errorf("Expecting %s with error %q, got %+v", name, want[name], result)
+		}
+	}
+
+	// Not ready once shutting down
+	checker.Shutdown()
+	report = checker.Run(context.Background())
+	if report.Ready() || report.Status != StatusShutdown {
+		t.Errorf("Expecting shutting down, got %+v", report)
+	}
+}
@@ -0,0 +1,104 @@
+// Package logging sets up structured JSON logging and carries
+// per-request fields, such as the request ID, in a context so
+// every log line written while handling a request includes them.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+// requestFields are the fields added to log lines of a request.
+// The user ID is only known once the handler authenticates.
+type requestFields struct {
+	requestID string
+	userID    atomic.Int64
+}
+
+// NewContext returns a copy of ctx carrying requestID.
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestFields{requestID: requestID})
+}
+
+func fieldsFrom(ctx context.Context) *requestFields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(contextKey{}).(*requestFields)
+	return fields
+}
+
+// RequestID returns the request ID in ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	if fields := fieldsFrom(ctx); fields != nil {
+		return fields.requestID
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user of the request in ctx.
+func SetUserID(ctx context.Context, userID int) {
+	if fields := fieldsFrom(ctx); fields != nil {
+		fields.userID.Store(int64(userID))
+	}
+}
+
+// UserID returns the authenticated user of the request in ctx, or 0.
+func UserID(ctx context.Context) int {
+	if fields := fieldsFrom(ctx); fields != nil {
+		return int(fields.userID.Load())
+	}
+	return 0
+}
+
+// Handler adds the request fields in the context to every record.
+type Handler struct {
+	slog.Handler
+}
+
+// Handle adds request_id, user_id and trace_id to r before passing it on.
+func (h Handler) Handle(ctx context.Context, r slog.Record) error {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		r.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	if fields := fieldsFrom(ctx); fields != nil {
+		r.AddAttrs(slog.String("request_id", fields.requestID))
+		if userID := fields.userID.Load(); userID != 0 {
+			r.AddAttrs(slog.Int64("user_id", userID))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs keeps adding request fields to records with attrs.
+func (h Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return Handler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps adding request fields to records in group name.
+func (h Handler) WithGroup(name string) slog.Handler {
+	return Handler{h.Handler.WithGroup(name)}
+}
+
+// New creates a logger writing JSON lines at level or above to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(Handler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// ParseLevel parses one of debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	level := slog.LevelInfo
+	err := level.UnmarshalText([]byte(strings.ToUpper(s)))
+	if err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
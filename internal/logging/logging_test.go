@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+
+	buf := bytes.Buffer{}
+	logger := New(&buf, slog.LevelInfo).With("component", "test")
+
+	ctx := NewContext(context.Background(), "req-1")
+	logger.InfoContext(ctx, "before auth")
+	SetUserID(ctx, 7)
+	logger.InfoContext(ctx, "after auth")
+	logger.Info("no request")
+	logger.DebugContext(ctx, "below level")
+
+	lines := []map[string]any{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		line := map[string]any{}
+		err := decoder.Decode(&line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("Expecting 3 lines, got %d", len(lines))
+	}
+	if lines[0]["request_id"] != "req-1" || lines[0]["user_id"] != nil || lines[0]["component"] != "test" {
+		t.Errorf("Unexpected line: %v", lines[0])
+	}
+	if lines[1]["request_id"] != "req-1" || lines[1]["user_id"] != float64(7) {
+		t.Errorf("Unexpected line: %v", lines[1])
+	}
+	if _, exist := lines[2]["request_id"]; exist {
+		t.Errorf("Unexpected request_id outside request: %v", lines[2])
+	}
+	if RequestID(ctx) != "req-1" || UserID(ctx) != 7 || RequestID(context.Background()) != "" {
+		t.Error("Unexpected request fields")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+
+	for input, expected := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		level, err := ParseLevel(input)
+		if err != nil || level != expected {
+			t.Errorf("ParseLevel(%q) = %v, %v", input, level, err)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("Expecting error for unknown level")
+	}
+}
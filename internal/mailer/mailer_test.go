@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+
+	buf := &bytes.Buffer{}
+	m := NewLogMailer(buf)
+
+	err := m.Send(Message{
+		To:      "nami@onepiece.com",
+		Subject: "Hello",
+		Body:    "Your token is abc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "To: nami@onepiece.com") || !strings.Contains(buf.String(), "Your token is abc") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// Header injection is rejected
+	err = m.Send(Message{
+		To:      "nami@onepiece.com\r\nBcc: everyone@onepiece.com",
+		Subject: "Hello",
+	})
+	if err == nil {
+		t.Error("Expecting error for recipient containing newline")
+	}
+}
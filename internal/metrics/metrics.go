@@ -0,0 +1,430 @@
+// Package metrics keeps counters, gauges and histograms in memory
+// and writes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited to request
+// and database latencies.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry served at /metrics.
+var Default = NewRegistry()
+
+// Collector is a metric that can be written to a Registry.
+type Collector interface {
+	// Name returns the name of the metric.
+	Name() string
+	// write writes every series of the metric.
+	write(w io.Writer) error
+}
+
+// Registry holds metrics and writes them in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+	names      map[string]bool
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		names: map[string]bool{},
+	}
+}
+
+// MustRegister adds collectors to r.
+// Panics if a metric with the same name was already registered.
+func (r *Registry) MustRegister(collectors ...Collector) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range collectors {
+		if r.names[c.Name()] {
+			panic("metrics: duplicate metric " + c.Name())
+		}
+		r.names[c.Name()] = true
+		r.collectors = append(r.collectors, c)
+	}
+}
+
+// WriteText writes every metric in r in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+
+	r.mu.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		err := c.write(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler serves the metrics in r in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// desc is the name, help and label names shared by metric types.
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) Name() string {
+	return d.name
+}
+
+func (d desc) writeHeader(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, kind)
+	return err
+}
+
+// series formats name with labels set to values, plus extra label pairs.
+func (d desc) series(name string, values []string, extra ...string) string {
+
+	pairs := []string{}
+	for i, label := range d.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// vec holds one child metric per combination of label values.
+type vec[T any] struct {
+	desc
+	mu       sync.RWMutex
+	children map[string]*T
+	values   map[string][]string
+	newChild func() *T
+}
+
+func newVec[T any](d desc, newChild func() *T) *vec[T] {
+	return &vec[T]{
+		desc:     d,
+		children: map[string]*T{},
+		values:   map[string][]string{},
+		newChild: newChild,
+	}
+}
+
+// with returns the child for values, creating it on first use.
+func (v *vec[T]) with(values []string) *T {
+
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, exist := v.children[key]
+	v.mu.RUnlock()
+	if exist {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if child, exist = v.children[key]; !exist {
+		child = v.newChild()
+		v.children[key] = child
+		v.values[key] = append([]string{}, values...)
+	}
+
+	return child
+}
+
+// each calls fn for every child sorted by label values.
+func (v *vec[T]) each(fn func(values []string, child *T) error) error {
+
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.mu.RLock()
+		child, values := v.children[key], v.values[key]
+		v.mu.RUnlock()
+
+		err := fn(values, child)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc adds 1 to c.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add adds n to c.
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Value returns the current value of c.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Reset sets c back to 0. Prometheus treats this like a restart.
+func (c *Counter) Reset() {
+	c.value.Store(0)
+}
+
+// CounterVec is a Counter for each combination of label values.
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// NewCounterVec creates a CounterVec with labels.
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(desc{name, help, labels}, func() *Counter { return &Counter{} })}
+}
+
+// WithLabelValues returns the Counter for values, in the order of the labels.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.with(values)
+}
+
+// Sum returns the total of every Counter in v.
+func (v *CounterVec) Sum() uint64 {
+	total := uint64(0)
+	v.each(func(_ []string, c *Counter) error {
+		total += c.Value()
+		return nil
+	})
+	return total
+}
+
+func (v *CounterVec) write(w io.Writer) error {
+
+	err := v.writeHeader(w, "counter")
+	if err != nil {
+		return err
+	}
+
+	return v.each(func(values []string, c *Counter) error {
+		_, err := fmt.Fprintf(w, "%s %d\n", v.series(v.name, values), c.Value())
+		return err
+	})
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	desc
+	value atomic.Int64
+}
+
+// NewGauge creates a Gauge.
+func NewGauge(name string, help string) *Gauge {
+	return &Gauge{desc: desc{name: name, help: help}}
+}
+
+// Inc adds 1 to g.
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+// Dec subtracts 1 from g.
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+// Set sets g to value.
+func (g *Gauge) Set(value int64) {
+	g.value.Store(value)
+}
+
+// Value returns the current value of g.
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+func (g *Gauge) write(w io.Writer) error {
+
+	err := g.writeHeader(w, "gauge")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s %d\n", g.name, g.Value())
+	return err
+}
+
+// GaugeFunc is a gauge whose value is computed when metrics are written.
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc creates a GaugeFunc calling fn for its value.
+func NewGaugeFunc(name string, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{desc: desc{name: name, help: help}, fn: fn}
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+
+	err := g.writeHeader(w, "gauge")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+	return err
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sumBits atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+// Observe adds value to h.
+func (h *Histogram) Observe(value float64) {
+
+	// Count first so a concurrent write never sees a bucket above the count
+	h.count.Add(1)
+
+	// Buckets are cumulative when written, so only count the first match
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.buckets) {
+		h.counts[i].Add(1)
+	}
+
+	for {
+		old := h.sumBits.Load()
+		sum := math.Float64frombits(old) + value
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(sum)) {
+			return
+		}
+	}
+}
+
+// ObserveSince adds the seconds elapsed since start to h.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count returns the number of observations in h.
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the total of the observations in h.
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sumBits.Load())
+}
+
+// HistogramVec is a Histogram for each combination of label values.
+type HistogramVec struct {
+	*vec[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates a HistogramVec with buckets in ascending order and labels.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		vec:     newVec(desc{name, help, labels}, func() *Histogram { return newHistogram(buckets) }),
+		buckets: buckets,
+	}
+}
+
+// WithLabelValues returns the Histogram for values, in the order of the labels.
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.with(values)
+}
+
+func (v *HistogramVec) write(w io.Writer) error {
+
+	err := v.writeHeader(w, "histogram")
+	if err != nil {
+		return err
+	}
+
+	return v.each(func(values []string, h *Histogram) error {
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += h.counts[i].Load()
+			_, err := fmt.Fprintf(w, "%s %d\n", v.series(v.name+"_bucket", values, "le", formatFloat(bound)), cumulative)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Read count after buckets so +Inf is never below a bucket,
+		// Observe counts before filling buckets
+		count := h.Count()
+		_, err := fmt.Fprintf(w, "%s %d\n%s %s\n%s %d\n",
+			v.series(v.name+"_bucket", values, "le", "+Inf"), count,
+			v.series(v.name+"_sum", values), formatFloat(h.Sum()),
+			v.series(v.name+"_count", values), count)
+		return err
+	})
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+
+	registry := NewRegistry()
+	requests := NewCounterVec("test_requests_total", "Requests handled.", "route", "status")
+	latency := NewHistogramVec("test_latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	active := NewGauge("test_active", "Active connections.")
+	sessions := NewGaugeFunc("test_sessions", "Active sessions.", func() float64 { return 3 })
+	registry.MustRegister(requests, latency, active, sessions)
+
+	requests.WithLabelValues("GET /b", "200").Inc()
+	requests.WithLabelValues("GET /a", "500").Add(2)
+	requests.WithLabelValues(`GET /"q"`, "200").Inc()
+	latency.WithLabelValues("GET /a").Observe(0.05)
+	latency.WithLabelValues("GET /a").Observe(0.5)
+	latency.WithLabelValues("GET /a").Observe(5)
+	active.Inc()
+	active.Inc()
+	active.Dec()
+
+	if total := requests.Sum(); total != 4 {
+		t.Errorf("%v != 4", total)
+	}
+
+	builder := strings.Builder{}
+	err := registry.WriteText(&builder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{route="GET /\"q\"",status="200"} 1
+test_requests_total{route="GET /a",status="500"} 2
+test_requests_total{route="GET /b",status="200"} 1
+# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="GET /a",le="0.1"} 1
+test_latency_seconds_bucket{route="GET /a",le="1"} 2
+test_latency_seconds_bucket{route="GET /a",le="+Inf"} 3
+test_latency_seconds_sum{route="GET /a"} 5.55
+test_latency_seconds_count{route="GET /a"} 3
+# HELP test_active Active connections.
+# TYPE test_active gauge
+test_active 1
+# HELP test_sessions Active sessions.
+# TYPE test_sessions gauge
+test_sessions 3
+`
+	if builder.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nExpecting:\n%s", builder.String(), expected)
+	}
+}
+
+func TestMustRegisterDuplicate(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expecting panic registering duplicate metric")
+		}
+	}()
+
+	registry := NewRegistry()
+	registry.MustRegister(NewGauge("test_dup", ""), NewGauge("test_dup", ""))
+}
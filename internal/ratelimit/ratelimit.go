@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy allows Requests per Period. Unused requests accumulate
+// up to Requests, so a client may send them all at once.
+type Policy struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParsePolicy parses a policy written as "<requests>/<period>",
+// for example "10/1m" or "100/h".
+func ParsePolicy(s string) (Policy, error) {
+
+	requestsString, periodString, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, expecting <requests>/<period>", s)
+	}
+
+	requests, err := strconv.Atoi(requestsString)
+	if err != nil || requests <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, requests must be a positive number", s)
+	}
+
+	// Allow "s", "m" and "h" as shorthand for one unit
+	if periodString == "s" || periodString == "m" || periodString == "h" {
+		periodString = "1" + periodString
+	}
+	period, err := time.ParseDuration(periodString)
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, period must be a positive duration", s)
+	}
+
+	return Policy{
+		Requests: requests,
+		Period:   period,
+	}, nil
+}
+
+// rate is the number of tokens added per second.
+func (p Policy) rate() float64 {
+	return float64(p.Requests) / p.Period.Seconds()
+}
+
+// Result is the outcome of a call to Allow.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	refill time.Duration // time for an empty bucket to fill up again
+}
+
+// Limiter is a set of token buckets keyed by client.
+type Limiter struct {
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+// NewLimiter creates an empty Limiter.
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets:     make(map[string]*bucket),
+		lastCleanup: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key if one is available.
+func (l *Limiter) Allow(key string, p Policy) (Result, error) {
+
+	if p.Requests <= 0 || p.Period <= 0 {
+		return Result{}, errors.New("rate limit policy must allow at least one request per period")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	capacity := float64(p.Requests)
+	rate := p.rate()
+
+	l.cleanup(now)
+
+	// Refill the bucket for the time since it was last used
+	b, exist := l.buckets[key]
+	if !exist {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	b.refill = p.Period
+
+	result := Result{
+		Limit: int(capacity),
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((capacity - b.tokens) / rate)
+
+	return result, nil
+}
+
+// cleanup forgets buckets that have been idle long enough to refill
+// completely. A forgotten bucket is recreated full, so dropping it
+// doesn't change the outcome of the next request.
+func (l *Limiter) cleanup(now time.Time) {
+
+	if now.Sub(l.lastCleanup) < time.Minute {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+
+	cases := []struct {
+		input    string
+		expected Policy
+		valid    bool
+	}{
+		{input: "10/1m", expected: Policy{Requests: 10, Period: time.Minute}, valid: true},
+		{input: "100/h", expected: Policy{Requests: 100, Period: time.Hour}, valid: true},
+		{input: "5/30s", expected: Policy{Requests: 5, Period: 30 * time.Second}, valid: true},
+		{input: "10", valid: false},
+		{input: "0/1m", valid: false},
+		{input: "10/forever", valid: false},
+	}
+
+	for _, c := range cases {
+		policy, err := ParsePolicy(c.input)
+		if c.valid && (err != nil || policy != c.expected) {
+			t.Errorf("%q: %v != %v (%v)", c.input, policy, c.expected, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%q: expecting error", c.input)
+		}
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+
+	now := time.Now()
+	limiter := NewLimiter()
+	limiter.now = func() time.Time { return now }
+
+	policy := Policy{Requests: 2, Period: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		result, err := limiter.Allow("ip:1", policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("Expecting request %d to be allowed", i+1)
+		}
+	}
+
+	// Bucket is empty
+	result, _ := limiter.Allow("ip:1", policy)
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expecting request to be denied: %+v", result)
+	}
+	if result.RetryAfter != 30*time.Second {
+		t.Errorf("%v != %v", result.RetryAfter, 30*time.Second)
+	}
+
+	// Other keys have their own bucket
+	result, _ = limiter.Allow("ip:2", policy)
+	if !result.Allowed {
+		t.Error("Expecting request from other key to be allowed")
+	}
+
+	// Tokens refill over time
+	now = now.Add(30 * time.Second)
+	result, _ = limiter.Allow("ip:1", policy)
+	if !result.Allowed {
+		t.Error("Expecting request to be allowed after refill")
+	}
+}
+
+func TestLimiterCleanup(t *testing.T) {
+
+	now := time.Now()
+	limiter := NewLimiter()
+	limiter.now = func() time.Time { return now }
+
+	daily := Policy{Requests: 1, Period: 24 * time.Hour}
+	minute := Policy{Requests: 1, Period: time.Minute}
+
+	limiter.Allow("ip:1", daily)
+	limiter.Allow("ip:2", minute)
+
+	// Idle buckets are kept until they would have refilled
+	now = now.Add(2 * time.Hour)
+	result, _ := limiter.Allow("ip:3", minute)
+	if !result.Allowed {
+		t.Fatal("Expecting request from new key to be allowed")
+	}
+	if _, exist := limiter.buckets["ip:2"]; exist {
+		t.Error("Expecting refilled bucket to be dropped")
+	}
+	result, _ = limiter.Allow("ip:1", daily)
+	if result.Allowed {
+		t.Error("Expecting daily limit to survive cleanup")
+	}
+}
@@ -0,0 +1,80 @@
+// Package tracing sets up OpenTelemetry tracing and helps
+// packages start spans that belong to a request.
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup installs the global tracer provider, exporting spans as JSON
+// to output: "stdout", or the path of a file to append to.
+// Tracing stays disabled when output is empty.
+// The returned function flushes remaining spans and stops exporting.
+func Setup(serviceName string, output string) (func(context.Context) error, error) {
+
+	// Accept trace context from clients and proxies either way
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	if output == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if output != "stdout" {
+		var err error
+		file, err = os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// StartChild starts a span named name only if ctx already carries one,
+// so background work like polling doesn't export a trace every tick.
+func StartChild(ctx context.Context, tracer trace.Tracer, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		return ctx, parent
+	}
+
+	return tracer.Start(ctx, name, opts...)
+}
+
+// RecordError marks span as failed with err.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
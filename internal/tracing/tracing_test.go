@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartChild(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	// No span is started without a parent
+	_, span := StartChild(context.Background(), tracer, "orphan")
+	span.End()
+	if len(recorder.Ended()) != 0 {
+		t.Fatalf("Expecting no spans, got %d", len(recorder.Ended()))
+	}
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := StartChild(ctx, tracer, "child")
+	child.End()
+	parent.End()
+
+	ended := recorder.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("Expecting 2 spans, got %d", len(ended))
+	}
+	if ended[0].Name() != "child" || ended[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expecting child of parent, got %s with parent %s", ended[0].Name(), ended[0].Parent().SpanID())
+	}
+}
@@ -0,0 +1,283 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+// Headers set on every webhook request.
+const (
+	SignatureHeader = "X-Chirpy-Signature"
+	TimestampHeader = "X-Chirpy-Timestamp"
+	EventHeader     = "X-Chirpy-Event"
+	DeliveryHeader  = "X-Chirpy-Delivery"
+)
+
+// dispatcherBuffer is how many events may wait to be queued.
+const dispatcherBuffer = 64
+
+// Dispatcher queues events published on a bus for every webhook
+// subscription that wants them and delivers them, retrying failed
+// deliveries with exponential backoff.
+// Deliveries are queued in the database so retries survive restarts.
+type Dispatcher struct {
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	PollInterval time.Duration
+	Client       *http.Client
+
+	db      *database.DB
+	bus     *events.Bus
+	sub     *events.Subscription
+	lastSeq uint64
+	wake    chan struct{}
+	now     func() time.Time
+}
+
+// NewDispatcher creates a Dispatcher delivering events published on bus
+// to the webhook subscriptions saved in db. Events published from now on
+// are delivered once Run is called.
+func NewDispatcher(db *database.DB, bus *events.Bus) *Dispatcher {
+
+	// Note where the bus is at, events published before are not ours
+	sub, recent := bus.SubscribeSince(0, dispatcherBuffer)
+	lastSeq := uint64(0)
+	if len(recent) > 0 {
+		lastSeq = recent[len(recent)-1].Seq
+	}
+
+	return &Dispatcher{
+		MaxAttempts:  8,
+		BaseDelay:    10 * time.Second,
+		MaxDelay:     time.Hour,
+		PollInterval: 5 * time.Second,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		db:           db,
+		bus:          bus,
+		sub:          sub,
+		lastSeq:      lastSeq,
+		wake:         make(chan struct{}, 1),
+		now:          time.Now,
+	}
+}
+
+// Run queues events until the bus is closed, and delivers them until
+// ctx is cancelled. Close the bus first so every event gets queued.
+func (d *Dispatcher) Run(ctx context.Context) {
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		d.queueEvents(ctx)
+	}()
+
+	go func() {
+		defer wg.Done()
+		d.deliverLoop(ctx)
+	}()
+
+	wg.Wait()
+}
+
+// Enqueue queues event for every subscription that wants it.
+func (d *Dispatcher) Enqueue(ctx context.Context, event events.Event) error {
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	queued, err := d.db.EnqueueWebhookDeliveries(ctx, event.ID, event.Type, string(payload))
+	if err != nil {
+		return err
+	}
+
+	// Deliver right away instead of waiting for the next poll
+	if queued > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// DeliverDue attempts every delivery that is due.
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+
+	deliveries, err := d.db.GetDueWebhookDeliveries(ctx, d.now())
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := d.deliver(ctx, delivery)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error delivering webhook", "delivery_id", delivery.ID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// queueEvents moves events from the bus to the delivery queue
+// until the bus is closed. Events are still queued after ctx is
+// cancelled, so none published before the bus closed are lost.
+func (d *Dispatcher) queueEvents(ctx context.Context) {
+
+	ctx = context.WithoutCancel(ctx)
+	sub := d.sub
+	defer func() { sub.Close() }()
+
+	for {
+		event, ok := <-sub.Events()
+		if !ok && d.bus.Closed() {
+			return
+		}
+		if !ok {
+			// Bus dropped us for falling behind, resubscribe and
+			// catch up on the events published in between
+			var missed []events.Event
+			sub, missed = d.bus.SubscribeSince(d.lastSeq, dispatcherBuffer)
+			if len(missed) > 0 && missed[0].Seq > d.lastSeq+1 {
+				slog.ErrorContext(ctx, "Webhook dispatcher fell too far behind the event bus, events were lost", "lost", missed[0].Seq-d.lastSeq-1)
+			}
+			for _, event := range missed {
+				d.queueEvent(ctx, event)
+			}
+			continue
+		}
+
+		d.queueEvent(ctx, event)
+	}
+}
+
+// queueEvent queues event and notes it was seen.
+func (d *Dispatcher) queueEvent(ctx context.Context, event events.Event) {
+
+	d.lastSeq = event.Seq
+
+	err := d.Enqueue(ctx, event)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error queueing webhook", "event_id", event.ID, "error", err)
+	}
+}
+
+// deliverLoop delivers due deliveries when woken and on every poll.
+func (d *Dispatcher) deliverLoop(ctx context.Context) {
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+
+		err := d.DeliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Error delivering webhooks", "error", err)
+		}
+	}
+}
+
+// deliver sends delivery once and records the attempt.
+func (d *Dispatcher) deliver(ctx context.Context, delivery database.WebhookDelivery) error {
+
+	sub, err := d.db.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	start := d.now()
+	attempt := database.WebhookAttempt{
+		AttemptedAt: start.UTC(),
+	}
+
+	statusCode, err := d.send(ctx, sub, delivery, start)
+	attempt.DurationMS = d.now().Sub(start).Milliseconds()
+	attempt.StatusCode = statusCode
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	status := database.DeliverySucceeded
+	nextAttemptAt := time.Time{}
+	if err != nil {
+		status = database.DeliveryPending
+		nextAttemptAt = start.Add(d.backoff(len(delivery.Attempts) + 1)).UTC()
+		if len(delivery.Attempts)+1 >= d.MaxAttempts {
+			status = database.DeliveryFailed
+			nextAttemptAt = time.Time{}
+		}
+	}
+
+	_, err = d.db.RecordWebhookAttempt(ctx, delivery.ID, attempt, status, nextAttemptAt)
+	return err
+}
+
+// send posts the payload of delivery to the subscription's url.
+// Any response other than 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, sub database.WebhookSubscription, delivery database.WebhookDelivery, now time.Time) (int, error) {
+
+	body := []byte(delivery.Payload)
+	timestamp := now.Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, auth.SignWebhook(sub.Secret, timestamp, body))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before retrying after attempts failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+
+	delay := d.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.MaxDelay {
+			return d.MaxDelay
+		}
+	}
+
+	return delay
+}
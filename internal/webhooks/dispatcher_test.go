@@ -0,0 +1,268 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+)
+
+func TestDispatcher(t *testing.T) {
+
+	ctx := context.Background()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Receiver fails the first request and verifies signatures
+	var mu sync.Mutex
+	requests := 0
+	verifier := auth.NewWebhookVerifier([]string{"whsec_test"}, time.Minute, SignatureHeader, TimestampHeader)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(EventHeader) != events.ChirpCreated {
+			t.Errorf("Unexpected event header %q", r.Header.Get(EventHeader))
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// Retries are re-signed so the same delivery is not rejected as a replay
+		if err := verifier.Verify(r.Header, body); err != nil {
+			t.Errorf("Unexpected signature error: %s", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	_, err = db.CreateWebhookSubscription(ctx, receiver.URL, []string{events.ChirpCreated}, "whsec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	dispatcher := NewDispatcher(db, bus)
+
+	// Only subscribed event types are queued
+	err = dispatcher.Enqueue(ctx, bus.Publish(events.ChirpDeleted, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := bus.Publish(events.ChirpCreated, map[string]int{"id": 1})
+	err = dispatcher.Enqueue(ctx, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// First attempt fails and is scheduled for retry
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	err = dispatcher.DeliverDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := db.GetWebhookDeliveries(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("Expecting 1 delivery, got %d", len(deliveries))
+	}
+	delivery := deliveries[0]
+	if delivery.Status != database.DeliveryPending || delivery.EventID != event.ID {
+		t.Errorf("Unexpected delivery: %+v", delivery)
+	}
+	if len(delivery.Attempts) != 1 || delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected attempts: %+v", delivery.Attempts)
+	}
+	if !delivery.NextAttemptAt.Equal(now.Add(dispatcher.BaseDelay).UTC()) {
+		t.Errorf("Unexpected next attempt %v", delivery.NextAttemptAt)
+	}
+
+	// Retry is not due before the backoff elapses
+	err = dispatcher.DeliverDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if requests != 1 {
+		t.Errorf("Expecting 1 request before backoff elapsed, got %d", requests)
+	}
+	mu.Unlock()
+
+	// Retry succeeds once due
+	now = now.Add(dispatcher.BaseDelay)
+	err = dispatcher.DeliverDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err = db.GetWebhookDeliveries(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deliveries[0].Status != database.DeliverySucceeded || len(deliveries[0].Attempts) != 2 {
+		t.Errorf("Unexpected delivery: %+v", deliveries[0])
+	}
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+
+	ctx := context.Background()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	_, err = db.CreateWebhookSubscription(ctx, receiver.URL, nil, "whsec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := NewDispatcher(db, events.NewBus())
+	dispatcher.MaxAttempts = 3
+
+	err = dispatcher.Enqueue(ctx, events.Event{ID: "evt_1", Type: events.ChirpDeleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+
+	for i := 0; i < dispatcher.MaxAttempts; i++ {
+		err = dispatcher.DeliverDue(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(dispatcher.MaxDelay)
+	}
+
+	deliveries, err := db.GetWebhookDeliveries(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deliveries[0].Status != database.DeliveryFailed || len(deliveries[0].Attempts) != 3 {
+		t.Errorf("Unexpected delivery: %+v", deliveries[0])
+	}
+}
+
+func TestDispatcherCatchesUp(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateWebhookSubscription(ctx, "http://localhost", nil, "whsec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events from before the dispatcher aren't queued
+	bus := events.NewBus()
+	bus.Publish(events.ChirpCreated, nil)
+	dispatcher := NewDispatcher(db, bus)
+
+	// Publish more than the dispatcher buffers, so the bus drops it
+	published := dispatcherBuffer + 10
+	for i := 0; i < published; i++ {
+		bus.Publish(events.ChirpCreated, nil)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.queueEvents(ctx)
+	}()
+
+	// Every event is queued once, including those published while dropped
+	deadline := time.Now().Add(5 * time.Second)
+	deliveries := []database.WebhookDelivery{}
+	for time.Now().Before(deadline) {
+		deliveries, err = db.GetWebhookDeliveries(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) >= published {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	bus.Close()
+	<-done
+
+	if len(deliveries) != published {
+		t.Errorf("Expecting %d deliveries, got %d", published, len(deliveries))
+	}
+}
+
+func TestDispatcherQueuesUntilBusCloses(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateWebhookSubscription(ctx, "http://localhost", nil, "whsec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	dispatcher := NewDispatcher(db, bus)
+	dispatcher.PollInterval = time.Hour
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.Run(ctx)
+	}()
+
+	// Events published while stopping are queued before Run returns
+	cancel()
+	bus.Publish(events.ChirpCreated, nil)
+	bus.Close()
+	<-done
+
+	deliveries, err := db.GetWebhookDeliveries(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Errorf("Expecting 1 delivery, got %d", len(deliveries))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+
+	dispatcher := &Dispatcher{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	for attempts, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 30: 5 * time.Second} {
+		if delay := dispatcher.backoff(attempts); delay != expected {
+			t.Errorf("backoff(%s) = %v, expecting %v", strconv.Itoa(attempts), delay, expected)
+		}
+	}
+}
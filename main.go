@@ -1,21 +1,52 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ahgr3y/chirpy/internal/auth"
 	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+	"github.com/ahgr3y/chirpy/internal/health"
+	"github.com/ahgr3y/chirpy/internal/logging"
+	"github.com/ahgr3y/chirpy/internal/mailer"
+	"github.com/ahgr3y/chirpy/internal/ratelimit"
+	"github.com/ahgr3y/chirpy/internal/tracing"
+	"github.com/ahgr3y/chirpy/internal/webhooks"
 	"github.com/joho/godotenv"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type apiConfig struct {
-	fileserverHits int
 	DB             *database.DB
 	jwtSecret      string
 	polkaKey       string
+	polkaVerifier  *auth.WebhookVerifier
+	adminKey       string
+	mailer         mailer.Mailer
+	passwordPolicy auth.PasswordPolicy
+	rateLimiter    *ratelimit.Limiter
+	rateLimits     map[string]routeRateLimit
+	events         *events.Bus
+	health         *health.Checker
+
+	// shutdown is closed when the server starts shutting down
+	// to end event streams, as they never go idle
+	shutdown chan struct{}
+
+	wsAllowedOrigins []string
 }
 
 func main() {
@@ -25,12 +56,76 @@ func main() {
 	// in the current directory
 	godotenv.Load()
 
+	// Log JSON lines at LOG_LEVEL, info by default
+	logLevel := slog.LevelInfo
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		level, err := logging.ParseLevel(value)
+		if err != nil {
+			fatal("Error loading LOG_LEVEL", err)
+		}
+		logLevel = level
+	}
+	slog.SetDefault(logging.New(os.Stdout, logLevel))
+
+	// Export traces to TRACE_OUTPUT, stdout or a file, if set
+	shutdownTracing, err := tracing.Setup("chirpy", os.Getenv("TRACE_OUTPUT"))
+	if err != nil {
+		fatal("Error setting up tracing", err)
+	}
+
 	// load the JWT
 	jwtSecret := os.Getenv("JWT_SECRET")
 
 	// Load polkaKey
 	polkaKey := os.Getenv("POLKA_KEY")
 
+	// Load polka webhook signing secrets, several can be
+	// given comma separated while rotating secrets
+	polkaVerifier, err := loadPolkaVerifier()
+	if err != nil {
+		fatal("Error loading polka webhook secrets", err)
+	}
+
+	// Load adminKey, admin endpoints are disabled without it
+	adminKey := os.Getenv("ADMIN_API_KEY")
+
+	// Load mailer
+	mail, err := newMailer()
+	if err != nil {
+		fatal("Error creating mailer", err)
+	}
+
+	// Load password hashing and policy
+	passwordPolicy, err := loadPasswordConfig()
+	if err != nil {
+		fatal("Error loading password config", err)
+	}
+
+	// Load rate limits
+	rateLimits, err := loadRateLimits()
+	if err != nil {
+		fatal("Error loading rate limits", err)
+	}
+
+	// Load origins of other sites whose pages may open WebSockets,
+	// comma separated. Pages of the server's own origin always may
+	wsAllowedOrigins := []string{}
+	for _, origin := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			wsAllowedOrigins = append(wsAllowedOrigins, origin)
+		}
+	}
+
+	// Load how long to keep serving after reporting not ready on shutdown,
+	// long enough for load balancers polling readiness to notice
+	drainDelay := 5 * time.Second
+	if value := os.Getenv("SHUTDOWN_DRAIN_DELAY"); value != "" {
+		drainDelay, err = time.ParseDuration(value)
+		if err != nil {
+			fatal("Error loading SHUTDOWN_DRAIN_DELAY", err)
+		}
+	}
+
 	// Set up debug flag
 	dbg := flag.Bool("debug", false, "Enable debug mode")
 
@@ -40,17 +135,17 @@ func main() {
 	// Implement debug flag logic
 	if *dbg { // Flag enabled
 
-		fmt.Println("Debug mode is enabled. Clearing database.json...")
+		slog.Info("Debug mode is enabled. Clearing database.json...")
 
 		// Delete database.json
 		err := os.Remove("database.json")
 		if err != nil {
-			log.Fatal(err)
+			fatal("Error clearing database.json", err)
 		} else {
-			fmt.Println("database.json cleared successfully")
+			slog.Info("database.json cleared successfully")
 		}
 	} else { // Flag disabled
-		fmt.Println("Running in normal mode...")
+		slog.Info("Running in normal mode...")
 	}
 
 	const rootFilepath = "."
@@ -58,63 +153,247 @@ func main() {
 
 	db, err := database.NewDB("database.json")
 	if err != nil {
-		log.Fatal(err)
+		fatal("Error opening database", err)
 	}
+	registerSessionMetrics(db)
 
 	apiCfg := apiConfig{
-		fileserverHits: 0,
 		DB:             db,
 		jwtSecret:      jwtSecret,
 		polkaKey:       polkaKey,
+		polkaVerifier:  polkaVerifier,
+		adminKey:       adminKey,
+		mailer:         mail,
+		passwordPolicy: passwordPolicy,
+		rateLimiter:    ratelimit.NewLimiter(),
+		rateLimits:     rateLimits,
+		events:         events.NewBus(),
+		health:         health.NewChecker(),
+
+		shutdown:         make(chan struct{}),
+		wsAllowedOrigins: wsAllowedOrigins,
 	}
+	apiCfg.registerHealthChecks()
 
-	// Create a ServeMux
-	serveMux := http.NewServeMux()
+	// Create a ServeMux with every route
+	serveMux := apiCfg.newServeMux(rootFilepath)
 
-	// Add a handler for the root path
-	// By default, FileServer will look for index.html
-	fileserverHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(rootFilepath))))
-	serveMux.Handle("/app/*", fileserverHandler)
+	// Create a pointer to a server. It speaks HTTP/2 without TLS
+	// as well, to clients which know it does or ask to upgrade
+	handler := middlewareCompression(middlewareTracing(serveMux, middlewareRequestLog(serveMux, middlewareMetrics(serveMux))))
+	http2Server := &http2.Server{}
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: h2c.NewHandler(handler, http2Server),
+	}
 
-	// Register handler for checking server readiness
-	serveMux.HandleFunc("/api/healthz", handlerReadinessGet)
-	serveMux.HandleFunc("POST /api/healthz", handlerReadinessPost)
-	serveMux.HandleFunc("DELETE /api/healthz", handlerReadinessDelete)
+	// Let Shutdown wait for HTTP/2 connections as well
+	err = http2.ConfigureServer(server, http2Server)
+	if err != nil {
+		fatal("Error configuring HTTP/2", err)
+	}
 
-	// Register handler to manage api metrics
-	serveMux.HandleFunc("/admin/metrics", apiCfg.handlerGetServerHits)
-	serveMux.HandleFunc("POST /admin/metrics", apiCfg.handlerPostServerHits)
-	serveMux.HandleFunc("DELETE /admin/metrics", apiCfg.handlerDeleteServerHits)
-	serveMux.HandleFunc("/api/reset", apiCfg.handlerResetServerHits)
+	// End event streams when shutting down, they never go idle
+	server.RegisterOnShutdown(func() { close(apiCfg.shutdown) })
 
-	// Register handler to manage chirps
-	serveMux.HandleFunc("POST /api/chirps", apiCfg.handlerPostChirp)
-	serveMux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
-	serveMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpGetByID)
-	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirpByID)
+	// Stop on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Register handler to manage users
-	serveMux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	serveMux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
-	serveMux.HandleFunc("POST /api/login", apiCfg.handlerUsersLogin)
-	serveMux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeUser)
+	// Start background workers. They get their own contexts so
+	// they keep running until requests finish, and see their events
+	publisherCtx, stopPublisher := context.WithCancel(context.Background())
+	defer stopPublisher()
+	var publisher sync.WaitGroup
+	publisher.Add(1)
+	go func() {
+		defer publisher.Done()
+		apiCfg.runChirpPublisher(publisherCtx, publishInterval)
+	}()
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	defer stopDispatcher()
+	var dispatcher sync.WaitGroup
+	dispatcher.Add(1)
+	go func() {
+		defer dispatcher.Done()
+		webhooks.NewDispatcher(db, apiCfg.events).Run(dispatcherCtx)
+	}()
 
-	// Register handler to manage user tokens
-	serveMux.HandleFunc("POST /api/refresh", apiCfg.handlerRefreshToken)
-	serveMux.HandleFunc("POST /api/revoke", apiCfg.handlerRevokeRefreshToken)
+	// Start the server
+	slog.Info("Serving files", "root", rootFilepath, "port", port)
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Error serving", err)
+		}
+	}()
 
-	// Create a pointer to a server
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: serveMux,
+	// Wait for interrupt, then let requests and workers finish
+	<-ctx.Done()
+	slog.Info("Shutting down...")
+
+	// Report not ready, and keep serving for a while so load
+	// balancers stop sending requests before connections close
+	apiCfg.health.Shutdown()
+	time.Sleep(drainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("Error shutting down server", "error", err)
 	}
 
-	// Start the server
-	log.Printf("Serving files from %s on port %s...\n", rootFilepath, port)
-	// Log errors
-	err = server.ListenAndServe()
+	// Stop publishing before closing the bus, so the dispatcher
+	// queues every event before it stops
+	stopPublisher()
+	publisher.Wait()
+	apiCfg.events.Close()
+	stopDispatcher()
+	dispatcher.Wait()
+
+	err = shutdownTracing(shutdownCtx)
+	if err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newMailer creates the Mailer configured by the environment.
+// Sends with SMTP when SMTP_HOST is set, otherwise writes emails
+// to MAIL_LOG_FILE or stdout for local development.
+func newMailer() (mailer.Mailer, error) {
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chirpy@localhost"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+
+		return mailer.SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	}
+
+	if path := os.Getenv("MAIL_LOG_FILE"); path != "" {
+		return mailer.NewFileMailer(path)
+	}
+
+	return mailer.NewLogMailer(os.Stdout), nil
+}
+
+// loadPasswordConfig configures password hashing from the environment
+// and returns the policy new passwords must follow.
+func loadPasswordConfig() (auth.PasswordPolicy, error) {
+
+	// Configure hashing of new passwords
+	hasher := auth.DefaultPasswordHasher
+	if algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm != "" {
+		hasher.Algorithm = algorithm
+	}
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		bcryptCost, err := strconv.Atoi(cost)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid BCRYPT_COST: %w", err)
+		}
+		hasher.BcryptCost = bcryptCost
+	}
+	if value := os.Getenv("ARGON2_TIME"); value != "" {
+		argon2Time, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid ARGON2_TIME: %w", err)
+		}
+		hasher.Argon2Time = uint32(argon2Time)
+	}
+	if value := os.Getenv("ARGON2_MEMORY"); value != "" {
+		// In KiB, like the Argon2 parameter
+		argon2Memory, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid ARGON2_MEMORY: %w", err)
+		}
+		hasher.Argon2Memory = uint32(argon2Memory)
+	}
+	if value := os.Getenv("ARGON2_THREADS"); value != "" {
+		argon2Threads, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid ARGON2_THREADS: %w", err)
+		}
+		hasher.Argon2Threads = uint8(argon2Threads)
+	}
+	err := auth.SetPasswordHasher(hasher)
 	if err != nil {
-		log.Fatal(err)
+		return auth.PasswordPolicy{}, err
+	}
+
+	policy := auth.PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 256,
+	}
+
+	// bcrypt ignores everything past 72 bytes
+	if hasher.Algorithm == auth.AlgorithmBcrypt {
+		policy.MaxLength = 72
+	}
+
+	if minLength := os.Getenv("PASSWORD_MIN_LENGTH"); minLength != "" {
+		policy.MinLength, err = strconv.Atoi(minLength)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %w", err)
+		}
+		// Empty passwords would let anyone in
+		if policy.MinLength < 1 {
+			return auth.PasswordPolicy{}, errors.New("invalid PASSWORD_MIN_LENGTH: must be at least 1")
+		}
+	}
+
+	// Load common or breached passwords
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		policy.Blocklist, err = auth.LoadPasswordBlocklist(path)
+		if err != nil {
+			return auth.PasswordPolicy{}, err
+		}
+	}
+
+	return policy, nil
+}
+
+// loadPolkaVerifier creates the verifier of signed Polka webhooks.
+// Returns nil if POLKA_WEBHOOK_SECRETS is not set.
+func loadPolkaVerifier() (*auth.WebhookVerifier, error) {
+
+	secrets := []string{}
+	for _, secret := range strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+
+	tolerance := 5 * time.Minute
+	if value := os.Getenv("POLKA_WEBHOOK_TOLERANCE"); value != "" {
+		var err error
+		tolerance, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POLKA_WEBHOOK_TOLERANCE: %w", err)
+		}
 	}
 
+	return auth.NewWebhookVerifier(secrets, tolerance, "X-Polka-Signature", "X-Polka-Timestamp"), nil
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPattern matches "@handle" at the start of a chirp or after whitespace.
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([a-zA-Z0-9_]+)`)
+
+// handlePattern matches the handles users can sign up with.
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// normalizeHandle returns handle in lowercase, since handles are matched
+// ignoring case, or a validation error if it can't be mentioned in chirps.
+// An empty handle is returned as it is.
+func normalizeHandle(handle string) (string, error) {
+
+	if handle == "" {
+		return "", nil
+	}
+
+	handle = strings.ToLower(handle)
+	if !handlePattern.MatchString(handle) {
+		return "", newValidationError("Invalid handle", fieldError{Field: "handle", Message: "may only contain letters, digits and underscores"})
+	}
+
+	return handle, nil
+}
+
+// mentionedHandles returns the handles mentioned in body without duplicates.
+func mentionedHandles(body string) []string {
+
+	handles := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(match[1])
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+
+	return handles
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMinBytes is the smallest response body worth compressing,
+// smaller ones can grow from the framing of the encoding.
+const compressMinBytes = 1024
+
+// Content codings responses are compressed with, preferred in this order
+// when the client accepts several equally.
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		writer, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return writer
+	}}
+	zstdWriters = sync.Pool{New: func() any {
+		// One goroutine per response, the server handles many at once
+		writer, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return writer
+	}}
+)
+
+// middlewareCompression compresses responses of next with zstd or gzip,
+// whichever Accept-Encoding prefers. Bodies smaller than compressMinBytes,
+// media which is compressed already, event streams and partial responses
+// are sent as they are.
+func middlewareCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Caches must keep a copy per encoding
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Entity tags of compressed responses name their encoding,
+		// handlers only know the tags of uncompressed ones
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		for _, name := range []string{"If-None-Match", "If-Match"} {
+			if value := r.Header.Get(name); value != "" {
+				r.Header.Set(name, stripEncodingETags(value))
+			}
+		}
+
+		writer := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			ifNoneMatch:    ifNoneMatch,
+		}
+		defer writer.Close()
+
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// negotiateEncoding returns the supported content coding acceptEncoding
+// prefers, or "" if the response should be sent uncompressed.
+func negotiateEncoding(acceptEncoding string) string {
+
+	best, bestQ := "", 0.0
+	wildcardQ := -1.0
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		name, value, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if coding == "*" {
+			wildcardQ = q
+			continue
+		}
+		qualities[coding] = q
+	}
+
+	for _, encoding := range []string{encodingZstd, encodingGzip} {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = max(wildcardQ, 0)
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// stripEncodingETags removes the encoding compressWriter adds to
+// the entity tags in an If-Match or If-None-Match header value.
+func stripEncodingETags(header string) string {
+
+	for _, encoding := range []string{encodingZstd, encodingGzip} {
+		header = strings.ReplaceAll(header, `-`+encoding+`"`, `"`)
+	}
+
+	return header
+}
+
+// compressibleType reports whether bodies of contentType shrink when compressed.
+func compressibleType(contentType string) bool {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "text/event-stream":
+		// Events must reach clients as soon as they are flushed
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/javascript",
+		mediaType == "image/svg+xml":
+		return true
+	}
+
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether
+// compressing it is worthwhile, then sends it compressed or as it is.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	ifNoneMatch string
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+
+	// Informational responses are followed by the real one
+	if code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+
+	// Flushed before the header was written
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	// Nothing to compress without a body
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide()
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < compressMinBytes {
+			return len(b), nil
+		}
+		err := cw.decide()
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide sends the header, compressed if the buffered start of the
+// body shows it is worthwhile, followed by the buffered body.
+func (cw *compressWriter) decide() error {
+
+	cw.decided = true
+	if cw.status == 0 {
+		return nil
+	}
+
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	etag := header.Get("ETag")
+	suffixedETag := ""
+	if strings.HasPrefix(etag, `"`) {
+		suffixedETag = strings.TrimSuffix(etag, `"`) + "-" + cw.encoding + `"`
+	}
+
+	compress := cw.status == http.StatusOK &&
+		len(cw.buf) >= compressMinBytes &&
+		header.Get("Content-Encoding") == "" &&
+		compressibleType(header.Get("Content-Type"))
+
+	switch {
+	case compress:
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		if suffixedETag != "" {
+			header.Set("ETag", suffixedETag)
+		}
+		cw.encoder = cw.newEncoder()
+	case cw.status == http.StatusNotModified && suffixedETag != "" && strings.Contains(cw.ifNoneMatch, suffixedETag):
+		// Client has the compressed copy
+		header.Set("ETag", suffixedETag)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// newEncoder returns an encoder of the negotiated coding writing to the response.
+func (cw *compressWriter) newEncoder() io.WriteCloser {
+
+	if cw.encoding == encodingZstd {
+		encoder := zstdWriters.Get().(*zstd.Encoder)
+		encoder.Reset(cw.ResponseWriter)
+		return encoder
+	}
+
+	encoder := gzipWriters.Get().(*gzip.Writer)
+	encoder.Reset(cw.ResponseWriter)
+	return encoder
+}
+
+// Close sends what is still buffered and ends the compressed stream.
+func (cw *compressWriter) Close() error {
+
+	if !cw.decided {
+		err := cw.decide()
+		if err != nil {
+			return err
+		}
+	}
+	if cw.encoder == nil {
+		return nil
+	}
+
+	err := cw.encoder.Close()
+	switch encoder := cw.encoder.(type) {
+	case *zstd.Encoder:
+		zstdWriters.Put(encoder)
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	}
+	cw.encoder = nil
+
+	return err
+}
+
+func (cw *compressWriter) Flush() {
+
+	if !cw.decided {
+		cw.decide()
+	}
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
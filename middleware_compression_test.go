@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+
+	cases := map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"gzip":                     encodingGzip,
+		"gzip, deflate, br, zstd":  encodingZstd,
+		"zstd;q=0.5, gzip":         encodingGzip,
+		"gzip;q=0, zstd;q=0":       "",
+		"*":                        encodingZstd,
+		"*;q=0.1, gzip;q=0.8":      encodingGzip,
+		"ZSTD;q=0.9, gzip;q=0.9":   encodingZstd,
+		"gzip;q=invalid, zstd;q=0": "",
+	}
+
+	for acceptEncoding, want := range cases {
+		got := negotiateEncoding(acceptEncoding)
+		if got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, expecting %q", acceptEncoding, got, want)
+		}
+	}
+}
+
+func TestMiddlewareCompression(t *testing.T) {
+
+	large := strings.Repeat(`{"body":"Hello, Chirpy!"},`, 100)
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("GET /json", func(w http.ResponseWriter, r *http.Request) {
+		if checkNotModified(w, r, `"json-1"`, cacheControlPublic) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, large)
+	})
+	serveMux.HandleFunc("GET /small", func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, http.StatusOK, "small")
+	})
+	serveMux.Handle("GET /app/", http.StripPrefix("/app", http.FileServer(http.Dir("."))))
+	handler := middlewareCompression(serveMux)
+
+	send := func(target, acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Large JSON is compressed with the preferred encoding
+	rec := send("/json", "gzip", "")
+	if rec.Header().Get("Content-Encoding") != encodingGzip || rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expecting gzip response, got headers %v", rec.Header())
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil || string(body) != large {
+		t.Errorf("Unexpected gzip body %q: %v", body, err)
+	}
+
+	rec = send("/json", "gzip, zstd", "")
+	if rec.Header().Get("Content-Encoding") != encodingZstd {
+		t.Fatalf("Expecting zstd response, got headers %v", rec.Header())
+	}
+	decoder, err := zstd.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+	body, err = io.ReadAll(decoder)
+	if err != nil || string(body) != large {
+		t.Errorf("Unexpected zstd body %q: %v", body, err)
+	}
+
+	// Compressed responses have their own entity tag, which revalidates
+	tag := rec.Header().Get("ETag")
+	if tag != `"json-1-zstd"` {
+		t.Errorf("Expecting ETag naming the encoding, got %q", tag)
+	}
+	rec = send("/json", "zstd", tag)
+	if rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != tag {
+		t.Errorf("Expecting 304 with ETag %s, got %d %v", tag, rec.Code, rec.Header())
+	}
+
+	// Small bodies, compressed media and clients without support get the body as it is
+	for _, c := range []struct {
+		target         string
+		acceptEncoding string
+	}{
+		{"/small", "gzip"},
+		{"/app/assets/logo.png", "gzip, zstd"},
+		{"/json", ""},
+		{"/json", "br"},
+	} {
+		rec = send(c.target, c.acceptEncoding, "")
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("GET %s with %q: expecting uncompressed 200, got %d %v", c.target, c.acceptEncoding, rec.Code, rec.Header())
+		}
+	}
+	if rec.Body.String() != large {
+		t.Errorf("Unexpected uncompressed body %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/logging"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+// middlewareRequestLog gives every request an ID, attaches it to the
+// log lines written while handling the request and writes one access
+// log line once next has responded.
+func middlewareRequestLog(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Keep the ID of a proxy in front of us so logs can be joined up
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		r = r.WithContext(logging.NewContext(r.Context(), requestID))
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		start := time.Now()
+		recorder := newResponseRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", recorder.Bytes()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_ip", clientIP(r)),
+		}
+		if recorder.errorMsg != "" {
+			attrs = append(attrs, slog.String("error", recorder.errorMsg))
+		}
+		slog.LogAttrs(r.Context(), level, "Handled request", attrs...)
+	})
+}
+
+// validRequestID reports whether an incoming request ID is safe to log and echo.
+func validRequestID(id string) bool {
+
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+
+	id, err := auth.GenerateSecureToken(16)
+	if err != nil {
+		// Logging without a unique ID beats failing the request
+		return "unknown"
+	}
+
+	return id
+}
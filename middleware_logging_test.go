@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahgr3y/chirpy/internal/logging"
+)
+
+func TestMiddlewareRequestLog(t *testing.T) {
+
+	buf := bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	defer slog.SetDefault(defaultLogger)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUserID(r.Context(), 7)
+		slog.InfoContext(r.Context(), "in handler")
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+	})
+	handler := middlewareRequestLog(mux, mux)
+
+	// Incoming request IDs are kept
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/1", nil)
+	req.Header.Set(requestIDHeader, "proxy-id.1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get(requestIDHeader) != "proxy-id.1" {
+		t.Errorf("Expecting request ID proxy-id.1, got %q", rec.Header().Get(requestIDHeader))
+	}
+
+	lines := []map[string]any{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		line := map[string]any{}
+		err := decoder.Decode(&line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expecting 2 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if line["request_id"] != "proxy-id.1" || line["user_id"] != float64(7) {
+			t.Errorf("Unexpected line: %v", line)
+		}
+	}
+	access := lines[1]
+	if access["route"] != "GET /api/chirps/{chirpID}" || access["status"] != float64(500) || access["level"] != "ERROR" || access["error"] != "Something went wrong" {
+		t.Errorf("Unexpected access line: %v", access)
+	}
+
+	// Unsafe request IDs are replaced
+	req = httptest.NewRequest(http.MethodGet, "/api/chirps/1", nil)
+	req.Header.Set(requestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get(requestIDHeader); id == "" || id == "bad id\n" {
+		t.Errorf("Expecting a new request ID, got %q", id)
+	}
+}
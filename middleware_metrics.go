@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec(
+		"chirpy_http_requests_total",
+		"HTTP requests handled, by route and status.",
+		"method", "route", "status",
+	)
+	httpDuration = metrics.NewHistogramVec(
+		"chirpy_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by route and status.",
+		metrics.DefaultBuckets,
+		"method", "route", "status",
+	)
+	fileserverHits = metrics.NewCounterVec(
+		"chirpy_fileserver_hits_total",
+		"Requests for the web app served from /app.",
+	)
+	openStreams = metrics.NewGauge(
+		"chirpy_open_event_streams",
+		"Clients connected to the chirp event stream.",
+	)
+	openWebSockets = metrics.NewGauge(
+		"chirpy_open_websockets",
+		"Clients connected over WebSocket.",
+	)
+)
+
+func init() {
+	metrics.Default.MustRegister(httpRequests, httpDuration, fileserverHits, openStreams, openWebSockets)
+
+	// Report 0 visits before the first one
+	fileserverHits.WithLabelValues()
+}
+
+// registerSessionMetrics reports the signed in sessions in db.
+func registerSessionMetrics(db *database.DB) {
+	metrics.Default.MustRegister(metrics.NewGaugeFunc(
+		"chirpy_active_sessions",
+		"Signed in sessions, counted by unexpired refresh tokens.",
+		func() float64 {
+			count, err := db.CountActiveRefreshTokens(context.Background())
+			if err != nil {
+				return 0
+			}
+			return float64(count)
+		},
+	))
+}
+
+// middlewareMetrics counts and times every request handled by mux,
+// labelled with the pattern of the route that matched.
+func middlewareMetrics(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Label by pattern rather than path to keep the number of series bounded
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		start := time.Now()
+		recorder := newResponseRecorder(w)
+		mux.ServeHTTP(recorder, r)
+
+		status := strconv.Itoa(recorder.Status())
+		httpRequests.WithLabelValues(r.Method, route, status).Inc()
+		httpDuration.WithLabelValues(r.Method, route, status).ObserveSince(start)
+	})
+}
+
+// Converts next to a Handler that counts requests for the web app
+func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fileserverHits.WithLabelValues().Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseRecorder remembers the status and size of a response.
+// It can still be flushed and hijacked for streams and WebSockets.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+
+	// errorMsg is the message of a server error response, for the access log
+	errorMsg string
+}
+
+// newResponseRecorder records the response to w, sharing the
+// recorder of an outer middleware if w already is one.
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the status sent, 200 if the handler sent nothing.
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Bytes returns the size of the response body written so far.
+func (rec *responseRecorder) Bytes() int64 {
+	return rec.bytes
+}
+
+func (rec *responseRecorder) Flush() {
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
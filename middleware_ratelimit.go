@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/entitlements"
+	"github.com/ahgr3y/chirpy/internal/ratelimit"
+)
+
+// routeRateLimit is the rate limit of a group of routes.
+// Users entitled to premium rate limits are limited by Premium instead of Default.
+type routeRateLimit struct {
+	Default ratelimit.Policy
+	Premium ratelimit.Policy
+}
+
+// defaultRateLimits are used for routes without a limit set in the environment.
+var defaultRateLimits = map[string]routeRateLimit{
+	"chirps": {
+		Default: ratelimit.Policy{Requests: 10, Period: time.Minute},
+		Premium: ratelimit.Policy{Requests: 60, Period: time.Minute},
+	},
+	"users": {
+		Default: ratelimit.Policy{Requests: 5, Period: time.Hour},
+		Premium: ratelimit.Policy{Requests: 5, Period: time.Hour},
+	},
+	"password_reset": {
+		Default: ratelimit.Policy{Requests: 5, Period: time.Hour},
+		Premium: ratelimit.Policy{Requests: 5, Period: time.Hour},
+	},
+}
+
+// loadRateLimits returns defaultRateLimits overridden by RATE_LIMIT_<NAME>
+// and RATE_LIMIT_<NAME>_RED environment variables, e.g. RATE_LIMIT_CHIRPS=20/1m.
+func loadRateLimits() (map[string]routeRateLimit, error) {
+
+	limits := make(map[string]routeRateLimit, len(defaultRateLimits))
+	for name, limit := range defaultRateLimits {
+		envName := "RATE_LIMIT_" + strings.ToUpper(name)
+
+		if value := os.Getenv(envName); value != "" {
+			policy, err := ratelimit.ParsePolicy(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", envName, err)
+			}
+			limit.Default = policy
+		}
+		if value := os.Getenv(envName + "_RED"); value != "" {
+			policy, err := ratelimit.ParsePolicy(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s_RED: %w", envName, err)
+			}
+			limit.Premium = policy
+		}
+
+		limits[name] = limit
+	}
+
+	return limits, nil
+}
+
+// middlewareRateLimit limits requests to next using the rate limit called name.
+// Requests are counted per user when the request is authenticated,
+// otherwise per client IP.
+func (cfg *apiConfig) middlewareRateLimit(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		limit, exist := cfg.rateLimits[name]
+		if !exist {
+			next(w, r)
+			return
+		}
+
+		// Work out who is making the request
+		key := name + ":ip:" + clientIP(r)
+		policy := limit.Default
+		if userID, err := cfg.identifyUser(r); err == nil {
+			key = name + ":user:" + strconv.Itoa(userID)
+
+			user, err := cfg.DB.GetUser(r.Context(), userID)
+			if err == nil && entitlements.ForUser(user).PremiumRateLimits {
+				policy = limit.Premium
+			}
+		}
+
+		result, err := cfg.rateLimiter.Allow(key, policy)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error applying rate limit", "limit", name, "error", err)
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			respondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded, try again later")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
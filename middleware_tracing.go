@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ahgr3y/chirpy/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/ahgr3y/chirpy")
+
+// middlewareTracing starts a span for every request handled by next,
+// named after the pattern of the route that matched. The span continues
+// the trace of the client when the request has a traceparent header.
+func middlewareTracing(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", clientIP(r)),
+			),
+		)
+		defer span.End()
+
+		recorder := newResponseRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.Status()
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", status),
+			attribute.Int64("http.response.body.size", recorder.Bytes()),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// startAuthSpan starts a span timing the authentication of r
+// and returns r with the span in its context.
+func startAuthSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+	ctx, span := tracing.StartChild(r.Context(), tracer, name)
+	return r.WithContext(ctx), span
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiVersionHeader = "API-Version"
+
+// Unversioned API paths are aliases of v1 kept for older clients
+// until they are removed at unversionedSunset.
+var (
+	unversionedDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	unversionedSunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// routeGroup mounts routes under a path prefix and wraps
+// their handlers with the middleware shared by the group.
+type routeGroup struct {
+	prefix     string
+	middleware []func(http.HandlerFunc) http.HandlerFunc
+}
+
+// newRouteGroup creates a routeGroup. The first middleware runs first.
+func newRouteGroup(prefix string, middleware ...func(http.HandlerFunc) http.HandlerFunc) routeGroup {
+	return routeGroup{
+		prefix:     prefix,
+		middleware: middleware,
+	}
+}
+
+// mount returns routes with patterns under the prefix of the group
+// and handlers wrapped by its middleware.
+func (g routeGroup) mount(routes []route) []route {
+
+	mounted := make([]route, 0, len(routes))
+	for _, rt := range routes {
+		method, path, found := strings.Cut(rt.pattern, " ")
+		pattern := g.prefix + rt.pattern
+		if found {
+			pattern = method + " " + g.prefix + path
+		}
+
+		handler := rt.handler
+		for i := len(g.middleware) - 1; i >= 0; i-- {
+			handler = g.middleware[i](handler)
+		}
+
+		mounted = append(mounted, route{pattern: pattern, handler: handler})
+	}
+
+	return mounted
+}
+
+// middlewareAPIVersion tells clients which version of the API responded.
+func middlewareAPIVersion(version string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(apiVersionHeader, version)
+			next(w, r)
+		}
+	}
+}
+
+// middlewareDeprecated marks unversioned API paths as deprecated with the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers, and links to the
+// same path under /api/v1 which replaces it.
+func middlewareDeprecated(deprecatedAt, sunset time.Time) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			successor := "/api/v1" + strings.TrimPrefix(r.URL.Path, "/api")
+
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecatedAt.Unix(), 10))
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+			next(w, r)
+		}
+	}
+}
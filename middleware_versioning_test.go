@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+
+	cfg, _ := newTestConfig(t)
+	serveMux := cfg.newServeMux(".")
+
+	for _, body := range []string{"First", "Second", "Third"} {
+		_, err := cfg.DB.CreateChirp(context.Background(), 1, body, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		serveMux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expecting status 200, got %d", target, rec.Code)
+		}
+		return rec
+	}
+
+	// Versioned paths aren't deprecated
+	rec := get("/api/v1/chirps")
+	if rec.Header().Get(apiVersionHeader) != "1" || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("Unexpected v1 headers %v", rec.Header())
+	}
+
+	// Unversioned paths are deprecated aliases of v1
+	rec = get("/api/chirps?sort=desc")
+	if rec.Header().Get(apiVersionHeader) != "1" {
+		t.Errorf("Expecting version 1, got %q", rec.Header().Get(apiVersionHeader))
+	}
+	if rec.Header().Get("Deprecation") != "@1792368000" || rec.Header().Get("Sunset") != "Fri, 30 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Unexpected deprecation headers %v", rec.Header())
+	}
+	if rec.Header().Get("Link") != `</api/v1/chirps>; rel="successor-version"` {
+		t.Errorf("Unexpected Link %q", rec.Header().Get("Link"))
+	}
+
+	// v2 pages through chirps
+	type page struct {
+		Chirps []struct {
+			ID int `json:"id"`
+		} `json:"chirps"`
+		NextCursor int `json:"next_cursor"`
+	}
+	pages := []page{}
+	target := "/api/v2/chirps?limit=2"
+	for target != "" {
+		rec = get(target)
+		if rec.Header().Get(apiVersionHeader) != "2" {
+			t.Errorf("Expecting version 2, got %q", rec.Header().Get(apiVersionHeader))
+		}
+
+		got := page{}
+		err := json.NewDecoder(rec.Body).Decode(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, got)
+
+		target = ""
+		if got.NextCursor != 0 {
+			target = "/api/v2/chirps?limit=2&cursor=" + strconv.Itoa(got.NextCursor)
+		}
+	}
+	if len(pages) != 2 || len(pages[0].Chirps) != 2 || pages[0].NextCursor != 2 || len(pages[1].Chirps) != 1 || pages[1].Chirps[0].ID != 3 {
+		t.Errorf("Unexpected pages %+v", pages)
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/events"
+	"github.com/ahgr3y/chirpy/internal/health"
+	"github.com/ahgr3y/chirpy/internal/mailer"
+	"github.com/ahgr3y/chirpy/internal/ratelimit"
+)
+
+// openAPIDoc holds the parts of openapi.json the contract tests check.
+type openAPIDoc struct {
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas   map[string]map[string]any  `json:"schemas"`
+		Responses map[string]openAPIResponse `json:"responses"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema map[string]any `json:"schema"`
+	} `json:"content"`
+}
+
+func loadOpenAPIDoc(t *testing.T) *openAPIDoc {
+	t.Helper()
+
+	doc := &openAPIDoc{}
+	err := json.Unmarshal(openAPISpec, doc)
+	if err != nil {
+		t.Fatalf("Error parsing openapi.json: %v", err)
+	}
+
+	return doc
+}
+
+// operation returns the documented operation of a ServeMux pattern.
+// Patterns without a method are documented as GET.
+func (doc *openAPIDoc) operation(pattern string) (openAPIOperation, bool) {
+
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = http.MethodGet, pattern
+	}
+
+	op, ok := doc.Paths[path][strings.ToLower(method)]
+	return op, ok
+}
+
+// checkResponse checks rec is a documented response of op.
+func (doc *openAPIDoc) checkResponse(op openAPIOperation, rec *httptest.ResponseRecorder) error {
+
+	resp, ok := op.Responses[fmt.Sprint(rec.Code)]
+	if !ok {
+		return fmt.Errorf("status %d not documented", rec.Code)
+	}
+	if resp.Ref != "" {
+		resp = doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+	}
+
+	if len(resp.Content) == 0 {
+		if rec.Body.Len() > 0 {
+			return fmt.Errorf("status %d documented without body, got %q", rec.Code, rec.Body.String())
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type: %w", err)
+	}
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("Content-Type %s not documented for status %d", mediaType, rec.Code)
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return nil
+	}
+
+	var body any
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	if err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	return doc.validate(content.Schema, body, "body")
+}
+
+// validate checks value matches schema. Only supports the parts
+// of JSON Schema used by openapi.json.
+func (doc *openAPIDoc) validate(schema map[string]any, value any, at string) error {
+
+	if ref, ok := schema["$ref"].(string); ok {
+		return doc.validate(doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")], value, at)
+	}
+
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, option := range oneOf {
+			if doc.validate(option.(map[string]any), value, at) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: matches %d schemas of oneOf", at, matches)
+		}
+		return nil
+	}
+
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: is null", at)
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		return fmt.Errorf("%s: %v not in %v", at, value, enum)
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expecting an object, got %T", at, value)
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing %s", at, name)
+			}
+		}
+		for name, fieldValue := range object {
+			property, ok := properties[name].(map[string]any)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: undocumented property %s", at, name)
+				}
+				continue
+			}
+			err := doc.validate(property, fieldValue, at+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expecting an array, got %T", at, value)
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range array {
+			err := doc.validate(items, item, fmt.Sprintf("%s[%d]", at, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expecting a string, got %T", at, value)
+		}
+		if schema["format"] == "date-time" {
+			_, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: expecting an integer, got %v", at, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expecting a number, got %T", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expecting a boolean, got %T", at, value)
+		}
+	}
+
+	return nil
+}
+
+// testMailer keeps sent emails so tests can read tokens from them.
+type testMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *testMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// count returns how many emails were sent.
+func (m *testMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages)
+}
+
+// tokenAfter waits for more than n emails to be sent, since some are sent
+// in the background, and returns the token on the last line of the last one.
+func (m *testMailer) tokenAfter(t *testing.T, n int) string {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); m.count() <= n; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for email")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lines := strings.Split(strings.TrimSpace(m.messages[len(m.messages)-1].Body), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func newTestConfig(t *testing.T) (*apiConfig, *testMailer) {
+	t.Helper()
+
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimits, err := loadRateLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := &testMailer{}
+	cfg := &apiConfig{
+		DB:             db,
+		jwtSecret:      "secret",
+		polkaKey:       "polkakey",
+		adminKey:       "adminkey",
+		mailer:         mail,
+		passwordPolicy: auth.PasswordPolicy{MinLength: 8, MaxLength: 72},
+		rateLimiter:    ratelimit.NewLimiter(),
+		rateLimits:     rateLimits,
+		events:         events.NewBus(),
+		health:         health.NewChecker(),
+	}
+	cfg.registerHealthChecks()
+	t.Cleanup(cfg.events.Close)
+
+	return cfg, mail
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+
+	doc := loadOpenAPIDoc(t)
+	cfg, _ := newTestConfig(t)
+
+	// Every route is documented, unversioned
+	// API paths as the v1 route they alias
+	documented := map[string]bool{}
+	for _, rt := range cfg.routes() {
+		method, path, found := strings.Cut(rt.pattern, " ")
+		if !found {
+			method, path = http.MethodGet, rt.pattern
+		}
+		documented[strings.ToLower(method)+" "+path] = true
+
+		if _, ok := doc.operation(rt.pattern); ok {
+			continue
+		}
+		v1Pattern := method + " /api/v1" + strings.TrimPrefix(path, "/api")
+		if _, ok := doc.operation(v1Pattern); !ok || !strings.HasPrefix(path, "/api/") {
+			t.Errorf("Route %s not documented", rt.pattern)
+		}
+	}
+
+	// Every documented operation is served
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if !documented[method+" "+path] {
+				t.Errorf("Documented operation %s %s not served", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIContract(t *testing.T) {
+
+	doc := loadOpenAPIDoc(t)
+	cfg, mail := newTestConfig(t)
+	serveMux := cfg.newServeMux(".")
+
+	// do sends a request and checks the response is documented
+	// and has the expected status. Returns the JSON body.
+	do := func(method, target string, body any, authorization string, status int) map[string]any {
+		t.Helper()
+
+		reqBody := &bytes.Buffer{}
+		if body != nil {
+			if raw, ok := body.(string); ok {
+				reqBody.WriteString(raw)
+			} else {
+				json.NewEncoder(reqBody).Encode(body)
+			}
+		}
+		req := httptest.NewRequest(method, target, reqBody)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		rec := httptest.NewRecorder()
+		serveMux.ServeHTTP(rec, req)
+
+		_, pattern := serveMux.Handler(req)
+		op, ok := doc.operation(pattern)
+		if !ok {
+			t.Fatalf("%s %s: route %q not documented", method, target, pattern)
+		}
+		err := doc.checkResponse(op, rec)
+		if err != nil {
+			t.Errorf("%s %s: %v", method, target, err)
+		}
+		if rec.Code != status {
+			t.Fatalf("%s %s: expecting status %d, got %d: %s", method, target, status, rec.Code, rec.Body.String())
+		}
+
+		resp := map[string]any{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	const admin = "ApiKey adminkey"
+
+	// Health and metadata
+	do("GET", "/api/healthz", nil, "", http.StatusOK)
+	do("POST", "/api/healthz", nil, "", http.StatusMethodNotAllowed)
+	do("GET", "/livez", nil, "", http.StatusOK)
+	do("GET", "/readyz", nil, "", http.StatusOK)
+	do("GET", "/api/openapi.json", nil, "", http.StatusOK)
+	do("GET", "/metrics", nil, "", http.StatusOK)
+	do("GET", "/admin/metrics", nil, "", http.StatusOK)
+
+	// Sign up, verify and log in
+	credentials := map[string]string{"email": "alice@example.com", "password": "longpassword"}
+	user := do("POST", "/api/v1/users", credentials, "", http.StatusCreated)
+	verifyToken := mail.tokenAfter(t, 0)
+	do("POST", "/api/v1/users", credentials, "", http.StatusConflict)
+	do("POST", "/api/v1/users", map[string]string{"email": "bob@example.com", "handle": "Bob", "password": "longpassword"}, "", http.StatusCreated)
+	do("POST", "/api/v1/users", map[string]string{"email": "alice", "password": "x"}, "", http.StatusUnprocessableEntity)
+	do("POST", "/api/v1/users", `{"email":`, "", http.StatusBadRequest)
+	do("POST", "/api/v1/users/verify", map[string]string{"token": verifyToken}, "", http.StatusOK)
+	do("POST", "/api/v1/users/verify/resend", nil, "", http.StatusUnauthorized)
+	session := do("POST", "/api/v1/login", credentials, "", http.StatusOK)
+	bearer := "Bearer " + session["token"].(string)
+	refresh := "Bearer " + session["refresh_token"].(string)
+	do("GET", "/api/v1/users/me", nil, bearer, http.StatusOK)
+	do("POST", "/api/v1/users/verify/resend", nil, bearer, http.StatusConflict)
+	do("POST", "/api/v1/refresh", nil, refresh, http.StatusOK)
+
+	// Chirps
+	chirp := do("POST", "/api/v1/chirps", map[string]any{"body": "Hello, Chirpy!"}, bearer, http.StatusCreated)
+	chirpPath := fmt.Sprintf("/api/v1/chirps/%v", chirp["id"])
+	do("POST", "/api/v1/chirps", map[string]any{"body": "Hi", "reply_to_id": chirp["id"]}, bearer, http.StatusCreated)
+	do("POST", "/api/v1/chirps", map[string]any{"body": "Hi", "extra": true}, bearer, http.StatusBadRequest)
+	do("POST", "/api/v1/chirps", map[string]any{"body": "Hi"}, "", http.StatusUnauthorized)
+	do("GET", "/api/v1/chirps?sort=desc", nil, "", http.StatusOK)
+	do("GET", fmt.Sprintf("/api/v1/chirps?author_id=%v", user["id"]), nil, "", http.StatusOK)
+	do("GET", "/api/v1/chirps?author_id=x", nil, "", http.StatusBadRequest)
+	if got := do("GET", chirpPath, nil, "", http.StatusOK); got["author_id"] != user["id"] {
+		t.Errorf("Expecting chirp by %v, got %v", user["id"], got["author_id"])
+	}
+	do("GET", "/api/v1/chirps/999", nil, "", http.StatusNotFound)
+	do("GET", "/api/v1/chirps/scheduled", nil, bearer, http.StatusOK)
+	do("PUT", chirpPath, map[string]any{"body": "Edited"}, bearer, http.StatusForbidden)
+	do("POST", chirpPath+"/likes", nil, bearer, http.StatusCreated)
+	do("POST", chirpPath+"/likes", nil, bearer, http.StatusOK)
+	do("DELETE", chirpPath+"/likes", nil, bearer, http.StatusNoContent)
+
+	// Notifications
+	do("GET", "/api/v1/notifications?limit=10", nil, bearer, http.StatusOK)
+	do("GET", "/api/v1/notifications?limit=1000", nil, bearer, http.StatusBadRequest)
+	do("POST", "/api/v1/notifications/read", map[string]any{"all": true}, bearer, http.StatusOK)
+
+	// Subscriptions
+	upgrade := map[string]any{"id": "evt_1", "event": "user.upgraded", "data": map[string]any{"user_id": user["id"]}}
+	do("POST", "/api/v1/polka/webhooks", upgrade, "ApiKey wrong", http.StatusUnauthorized)
+	do("POST", "/api/v1/polka/webhooks", upgrade, "ApiKey polkakey", http.StatusNoContent)
+	do("POST", "/api/v1/polka/webhooks", map[string]any{"event": "user.upgraded", "data": map[string]any{"user_id": user["id"]}}, "ApiKey polkakey", http.StatusUnprocessableEntity)
+	do("PUT", chirpPath, map[string]any{"body": "Edited"}, bearer, http.StatusOK)
+	do("GET", "/admin/subscriptions", nil, admin, http.StatusOK)
+	do("GET", "/admin/subscriptions", nil, "", http.StatusUnauthorized)
+
+	// API keys
+	key := do("POST", "/api/v1/users/me/keys", map[string]any{"name": "cli", "scopes": []string{"chirps:write"}}, bearer, http.StatusCreated)
+	do("POST", "/api/v1/users/me/keys", map[string]any{"name": "cli", "scopes": []string{"admin"}}, bearer, http.StatusUnprocessableEntity)
+	do("GET", "/api/v1/users/me/keys", nil, bearer, http.StatusOK)
+	do("POST", "/api/v1/chirps", map[string]any{"body": "From the CLI"}, "ApiKey "+key["key"].(string), http.StatusCreated)
+	do("DELETE", fmt.Sprintf("/api/v1/users/me/keys/%v", key["id"]), nil, bearer, http.StatusNoContent)
+
+	// Two-factor authentication
+	do("POST", "/api/v1/users/me/2fa/enroll", nil, bearer, http.StatusOK)
+	do("POST", "/api/v1/users/me/2fa/confirm", map[string]any{"code": "000000"}, bearer, http.StatusBadRequest)
+	do("POST", "/api/v1/login/2fa", map[string]any{"challenge_token": "invalid", "code": "000000"}, "", http.StatusUnauthorized)
+
+	// Webhooks
+	webhook := do("POST", "/api/v1/webhooks", map[string]any{"url": "https://example.com/hook", "events": []string{"chirp.created"}}, admin, http.StatusCreated)
+	webhookPath := fmt.Sprintf("/api/v1/webhooks/%v", webhook["id"])
+	do("POST", "/api/v1/webhooks", map[string]any{"url": "example.com", "events": []string{"chirp.created"}}, admin, http.StatusUnprocessableEntity)
+	do("GET", "/api/v1/webhooks", nil, admin, http.StatusOK)
+	do("GET", webhookPath+"/deliveries", nil, admin, http.StatusOK)
+	do("DELETE", webhookPath, nil, admin, http.StatusNoContent)
+
+	// Account changes
+	do("POST", fmt.Sprintf("/admin/users/%v/unlock", user["id"]), nil, admin, http.StatusOK)
+	do("PUT", "/api/v1/users", map[string]string{"email": "alice@example.org", "handle": "bob", "password": "anotherpassword"}, bearer, http.StatusConflict)
+	updated := do("PUT", "/api/v1/users", map[string]string{"email": "alice@example.org", "handle": "Alice", "password": "anotherpassword"}, bearer, http.StatusOK)
+	if updated["handle"] != "alice" {
+		t.Errorf("Expecting handle alice, got %v", updated["handle"])
+	}
+	sent := mail.count()
+	do("POST", "/api/v1/password-reset/request", map[string]string{"email": "alice@example.org"}, "", http.StatusAccepted)
+	resetToken := mail.tokenAfter(t, sent)
+	do("POST", "/api/v1/password-reset/confirm", map[string]string{"token": resetToken, "password": "alice@example.org"}, "", http.StatusUnprocessableEntity)
+	do("POST", "/api/v1/password-reset/confirm", map[string]string{"token": resetToken, "password": "yetanotherpassword"}, "", http.StatusNoContent)
+	do("POST", "/api/v1/password-reset/confirm", map[string]string{"token": resetToken, "password": "yetanotherpassword"}, "", http.StatusBadRequest)
+	do("GET", "/api/v2/chirps?limit=1", nil, "", http.StatusOK)
+	do("GET", "/api/v2/chirps?cursor=x", nil, "", http.StatusBadRequest)
+	do("DELETE", chirpPath, nil, bearer, http.StatusNoContent)
+	do("POST", "/api/v1/revoke", nil, refresh, http.StatusNoContent)
+	do("POST", "/api/v1/refresh", nil, refresh, http.StatusUnauthorized)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxBodyBytes is the largest request body handlers will read.
+const maxBodyBytes = 1 << 20
+
+var (
+	errBodyTooLarge = &apiError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    codeTooLarge,
+		Message: "Request body too large",
+	}
+	errUnsupportedMediaType = &apiError{
+		Status:  http.StatusUnsupportedMediaType,
+		Code:    codeMediaType,
+		Message: "Content-Type must be application/json",
+	}
+)
+
+// decodeJSON decodes the JSON request body into dst and checks it
+// against the validate tags of dst. Returns an *apiError explaining
+// what is wrong with the request, ready for respondWithErr.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+
+	err := checkContentType(r)
+	if err != nil {
+		return err
+	}
+
+	// Fields the endpoint doesn't know are mistakes of the client
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(dst)
+	if err != nil {
+		return decodeError(err)
+	}
+
+	// Body must hold a single JSON value
+	err = decoder.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		if err != nil {
+			return decodeError(err)
+		}
+		return errInvalidJSON
+	}
+
+	return validate(dst)
+}
+
+// readBody reads the raw JSON request body for handlers which need
+// its exact bytes, such as to check a signature.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+
+	err := checkContentType(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		return nil, decodeError(err)
+	}
+
+	return body, nil
+}
+
+// checkContentType makes sure the request body is sent as JSON.
+func checkContentType(r *http.Request) error {
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return errUnsupportedMediaType
+	}
+
+	return nil
+}
+
+// decodeError converts an error from decoding a request body to an *apiError.
+func decodeError(err error) error {
+
+	maxBytesErr := &http.MaxBytesError{}
+	typeErr := &json.UnmarshalTypeError{}
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return errBodyTooLarge
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return invalidJSONError(fieldError{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return invalidJSONError(fieldError{Field: field, Message: "unknown field"})
+	}
+
+	return errInvalidJSON
+}
+
+// invalidJSONError reports a body which is valid JSON
+// but doesn't have the shape the endpoint expects.
+func invalidJSONError(fields ...fieldError) *apiError {
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Code:    codeInvalidJSON,
+		Message: errInvalidJSON.Message,
+		Fields:  fields,
+	}
+}
+
+// jsonTypeName names t the way API clients know it.
+func jsonTypeName(t reflect.Type) string {
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+
+	return "an object"
+}
+
+// validate checks the fields of the struct v points to against the rules
+// in their validate tags, separated by commas:
+//
+//	required  must be set, and not empty for strings and arrays
+//	email     must be a bare email address
+//	url       must be an absolute http or https URL
+//	min=N     strings need at least N characters, arrays N items, numbers a value of N
+//	max=N     strings may have at most N characters, arrays N items, numbers a value of N
+//
+// Rules other than required only apply to fields which are set.
+// Nested structs are checked as well. Returns a validation error
+// listing every broken rule, or nil.
+func validate(v any) error {
+
+	fields := validateStruct(reflect.ValueOf(v), "")
+	if len(fields) > 0 {
+		return newValidationError("Invalid request body", fields...)
+	}
+
+	return nil
+}
+
+// validateStruct collects the broken rules of the struct v.
+// Names of its fields are prefixed with prefix.
+func validateStruct(v reflect.Value, prefix string) []fieldError {
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := []fieldError{}
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		name := jsonFieldName(structField)
+		if name == "" {
+			continue
+		}
+		name = prefix + name
+
+		msg := checkRules(v.Field(i), structField.Tag.Get("validate"))
+		if msg != "" {
+			fields = append(fields, fieldError{Field: name, Message: msg})
+			continue
+		}
+
+		fields = append(fields, validateStruct(v.Field(i), name+".")...)
+	}
+
+	return fields
+}
+
+// jsonFieldName returns the name of field in JSON bodies,
+// or "" if it isn't decoded from JSON.
+func jsonFieldName(field reflect.StructField) string {
+
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+// checkRules returns why value breaks the comma separated rules, or "".
+func checkRules(value reflect.Value, rules string) string {
+
+	if rules == "" {
+		return ""
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		if rule == "required" {
+			if value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0) {
+				return "is required"
+			}
+			continue
+		}
+
+		// Unset fields are optional unless required
+		if value.IsZero() {
+			return ""
+		}
+		for value.Kind() == reflect.Pointer {
+			value = value.Elem()
+		}
+
+		msg := checkRule(value, rule)
+		if msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+// checkRule returns why value breaks rule, or "".
+// Panics on unknown rules since those are programming errors.
+func checkRule(value reflect.Value, rule string) string {
+
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "email":
+		addr, err := mail.ParseAddress(value.String())
+		if err != nil || addr.Address != value.String() {
+			return "must be a valid email address"
+		}
+	case "url":
+		target, err := url.Parse(value.String())
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return "must be an absolute http or https URL"
+		}
+	case "min", "max":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validate: invalid rule %q", rule))
+		}
+		size, unit := ruleSize(value)
+		if name == "min" && size < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if name == "max" && size > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", rule))
+	}
+
+	return ""
+}
+
+// ruleSize returns what min and max rules compare for value, with its unit.
+func ruleSize(value reflect.Value) (int, string) {
+
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len(), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(value.Int()), ""
+	}
+
+	panic(fmt.Sprintf("validate: min and max don't apply to %s", value.Kind()))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ahgr3y/chirpy/internal/auth"
+	"github.com/ahgr3y/chirpy/internal/database"
+	"github.com/ahgr3y/chirpy/internal/logging"
+	"github.com/ahgr3y/chirpy/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// authenticateUser returns the id of the user making the request.
+// A JWT ("Bearer" scheme) is always accepted. A personal API key
+// ("ApiKey" scheme) is only accepted when scope is not empty and
+// the key was granted that scope.
+func (cfg *apiConfig) authenticateUser(r *http.Request, scope string) (userID int, err error) {
+
+	r, span := startAuthSpan(r, "auth.authenticate_user")
+	defer func() { endAuthSpan(span, err) }()
+
+	// Authenticate with personal API key
+	if strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		if scope == "" {
+			return 0, errors.New("api keys are not accepted for this request")
+		}
+
+		key, err := cfg.apiKeyFromRequest(r)
+		if err != nil {
+			return 0, err
+		}
+		if !key.HasScope(scope) {
+			return 0, errors.New("api key missing scope " + scope)
+		}
+
+		logging.SetUserID(r.Context(), key.UserID)
+		return key.UserID, nil
+	}
+
+	return cfg.userIDFromJWT(r)
+}
+
+// identifyUser returns the id of the user making the request with either
+// a JWT or a personal API key, without checking what the credentials may do.
+func (cfg *apiConfig) identifyUser(r *http.Request) (userID int, err error) {
+
+	r, span := startAuthSpan(r, "auth.identify_user")
+	defer func() { endAuthSpan(span, err) }()
+
+	if strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		key, err := cfg.apiKeyFromRequest(r)
+		if err != nil {
+			return 0, err
+		}
+
+		logging.SetUserID(r.Context(), key.UserID)
+		return key.UserID, nil
+	}
+
+	return cfg.userIDFromJWT(r)
+}
+
+// userIDFromJWT validates the JWT in the request header.
+// Returns id of user if token is valid.
+func (cfg *apiConfig) userIDFromJWT(r *http.Request) (int, error) {
+
+	// Extract token from request header
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("auth.scheme", "jwt"))
+
+	userID, err := cfg.userIDFromToken(token)
+	if err != nil {
+		return 0, err
+	}
+
+	// Add the user to log lines of the request
+	logging.SetUserID(r.Context(), userID)
+	return userID, nil
+}
+
+// userIDFromToken validates token as an access JWT.
+// Returns id of user if token is valid.
+func (cfg *apiConfig) userIDFromToken(token string) (int, error) {
+
+	// Validate signature of token
+	// and retrieve user id if token is valid
+	idString, err := auth.ExtractIDFromToken(token, cfg.jwtSecret)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(idString)
+}
+
+// apiKeyFromRequest looks up the unexpired personal API key in the request header.
+func (cfg *apiConfig) apiKeyFromRequest(r *http.Request) (database.APIKey, error) {
+
+	apiKey, err := auth.ExtractApiKey(r.Header)
+	if err != nil {
+		return database.APIKey{}, err
+	}
+
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("auth.scheme", "api_key"))
+
+	key, err := cfg.DB.GetAPIKeyByHash(r.Context(), auth.HashToken(apiKey))
+	if err != nil {
+		return database.APIKey{}, err
+	}
+	if key.Expired() {
+		return database.APIKey{}, errors.New("api key expired")
+	}
+
+	return key, nil
+}
+
+// authenticateAdmin checks the request carries the admin API key.
+// Admin endpoints are disabled when no admin key is configured.
+func (cfg *apiConfig) authenticateAdmin(r *http.Request) (err error) {
+
+	_, span := startAuthSpan(r, "auth.authenticate_admin")
+	defer func() { endAuthSpan(span, err) }()
+
+	if cfg.adminKey == "" {
+		return errors.New("admin api key not configured")
+	}
+
+	apiKey, err := auth.ExtractApiKey(r.Header)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminKey)) != 1 {
+		return errors.New("invalid admin api key")
+	}
+
+	return nil
+}
+
+// endAuthSpan ends span, marking it failed if authentication failed with err.
+func endAuthSpan(span trace.Span, err error) {
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	span.End()
+}
+
+// clientIP returns the IP address the request was sent from.
+func clientIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
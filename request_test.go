@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+
+	type parameters struct {
+		Email  string   `json:"email" validate:"required,email"`
+		Name   string   `json:"name" validate:"max=5"`
+		Scopes []string `json:"scopes" validate:"required"`
+		Data   struct {
+			UserID int `json:"user_id" validate:"min=1"`
+		} `json:"data"`
+	}
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		fields      []fieldError
+	}{
+		{
+			name:        "valid",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"email":"a@b.co","name":"chirp","scopes":["chirps:read"],"data":{"user_id":1}}`,
+		},
+		{
+			name:        "wrong content type",
+			contentType: "text/plain",
+			body:        `{"email":"a@b.co","scopes":["x"]}`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "too large",
+			contentType: "application/json",
+			body:        `{"email":"` + strings.Repeat("a", maxBodyBytes) + `"}`,
+			status:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "malformed",
+			contentType: "application/json",
+			body:        `{"email":`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "trailing data",
+			contentType: "application/json",
+			body:        `{"email":"a@b.co","scopes":["x"]}{}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "unknown field",
+			contentType: "application/json",
+			body:        `{"email":"a@b.co","scopes":["x"],"admin":true}`,
+			status:      http.StatusBadRequest,
+			fields:      []fieldError{{Field: "admin", Message: "unknown field"}},
+		},
+		{
+			name:        "wrong type",
+			contentType: "application/json",
+			body:        `{"email":"a@b.co","scopes":["x"],"data":{"user_id":"1"}}`,
+			status:      http.StatusBadRequest,
+			fields:      []fieldError{{Field: "data.user_id", Message: "must be an integer"}},
+		},
+		{
+			name:        "broken rules",
+			contentType: "application/json",
+			body:        `{"email":"Chirpy <a@b.co>","name":"chirpy","scopes":[],"data":{"user_id":-1}}`,
+			status:      http.StatusUnprocessableEntity,
+			fields: []fieldError{
+				{Field: "email", Message: "must be a valid email address"},
+				{Field: "name", Message: "must be at most 5 characters"},
+				{Field: "scopes", Message: "is required"},
+				{Field: "data.user_id", Message: "must be at least 1"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+
+		param := parameters{}
+		err := decodeJSON(httptest.NewRecorder(), req, &param)
+		if c.status == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+
+		apiErr := &apiError{}
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("%s: expecting an API error, got %v", c.name, err)
+		}
+		if apiErr.Status != c.status {
+			t.Errorf("%s: expecting status %d, got %d", c.name, c.status, apiErr.Status)
+		}
+		if c.fields != nil && !reflect.DeepEqual(apiErr.Fields, c.fields) {
+			t.Errorf("%s: expecting fields %v, got %v", c.name, c.fields, apiErr.Fields)
+		}
+	}
+}
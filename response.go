@@ -2,23 +2,170 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+// Error codes clients can rely on, unlike error messages.
+const (
+	codeBadRequest      = "bad_request"
+	codeInvalidJSON     = "invalid_json"
+	codeValidation      = "validation_failed"
+	codeUnauthorized    = "unauthorized"
+	codeForbidden       = "forbidden"
+	codeNotFound        = "not_found"
+	codeConflict        = "conflict"
+	codeDuplicateEmail  = "duplicate_email"
+	codeDuplicateHandle = "duplicate_handle"
+	codeRateLimited     = "rate_limited"
+	codeTooLarge        = "payload_too_large"
+	codeMediaType       = "unsupported_media_type"
+	codePrecondition    = "precondition_failed"
+	codeInternal        = "internal_error"
+	codeUnavailable     = "unavailable"
 )
 
+// apiError is an error response. It is sent as an RFC 7807
+// problem details object with the code and field errors as extensions.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []fieldError
+}
+
+// fieldError explains what is wrong with a field of the request body.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// errInvalidJSON is the response to request bodies that can't be decoded.
+var errInvalidJSON = &apiError{
+	Status:  http.StatusBadRequest,
+	Code:    codeInvalidJSON,
+	Message: "Invalid request body",
+}
+
+// newValidationError reports the problems with fields of a request body
+// that was decoded fine but holds values the endpoint can't accept.
+func newValidationError(message string, fields ...fieldError) *apiError {
+	return &apiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    codeValidation,
+		Message: message,
+		Fields:  fields,
+	}
+}
+
+// respondWithError responds with errorMsg and the default code for code.
 func respondWithError(w http.ResponseWriter, code int, errorMsg string) {
+	respondWithAPIError(w, &apiError{
+		Status:  code,
+		Code:    defaultErrorCode(code),
+		Message: errorMsg,
+	})
+}
+
+// respondWithErr responds with the status err maps to. Errors that
+// aren't API errors or database sentinel errors are logged as 500s.
+func respondWithErr(w http.ResponseWriter, r *http.Request, err error) {
 
-	if code > 499 {
-		log.Printf("Unexpected error: %d - %s", code, errorMsg)
+	apiErr := &apiError{}
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.Is(err, database.ErrNotFound):
+		apiErr = &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: "Not found"}
+	case errors.Is(err, database.ErrDuplicateEmail):
+		apiErr = &apiError{Status: http.StatusConflict, Code: codeDuplicateEmail, Message: "Email address already in use"}
+	case errors.Is(err, database.ErrDuplicateHandle):
+		apiErr = &apiError{Status: http.StatusConflict, Code: codeDuplicateHandle, Message: "Handle already in use"}
+	case errors.Is(err, database.ErrForbidden):
+		apiErr = &apiError{Status: http.StatusForbidden, Code: codeForbidden, Message: "Forbidden"}
+	case errors.Is(err, database.ErrVersionConflict):
+		apiErr = errPreconditionFailed
+	default:
+		slog.ErrorContext(r.Context(), "Unexpected error", "error", err)
+		apiErr = &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "Something went wrong"}
 	}
 
-	type errorResponse struct {
-		Error string `json:"error"`
+	respondWithAPIError(w, apiErr)
+}
+
+// respondWithAPIError sends apiErr as application/problem+json.
+func respondWithAPIError(w http.ResponseWriter, apiErr *apiError) {
+
+	// The access log reports server errors with their message
+	if rec, ok := w.(*responseRecorder); ok && apiErr.Status > 499 {
+		rec.errorMsg = apiErr.Message
+	}
+
+	type problem struct {
+		Type   string       `json:"type"`
+		Title  string       `json:"title"`
+		Status int          `json:"status"`
+		Detail string       `json:"detail"`
+		Code   string       `json:"code"`
+		Errors []fieldError `json:"errors,omitempty"`
 	}
 
-	respondWithJSON(w, code, errorResponse{
-		Error: errorMsg,
+	dat, err := json.Marshal(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(apiErr.Status),
+		Status: apiErr.Status,
+		Detail: apiErr.Message,
+		Code:   apiErr.Code,
+		Errors: apiErr.Fields,
 	})
+	if err != nil {
+		slog.Error("Error marshalling JSON", "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(apiErr.Status)
+	w.Write(dat)
+}
+
+// defaultErrorCode returns the error code of responses with status.
+func defaultErrorCode(status int) string {
+
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusPreconditionFailed:
+		return codePrecondition
+	case http.StatusRequestEntityTooLarge:
+		return codeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return codeMediaType
+	case http.StatusUnprocessableEntity:
+		return codeValidation
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	}
+
+	if status >= http.StatusInternalServerError {
+		return codeInternal
+	}
+	return codeBadRequest
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, respBody interface{}) {
@@ -26,7 +173,7 @@ func respondWithJSON(w http.ResponseWriter, code int, respBody interface{}) {
 	// Parse responseVal struct to JSON
 	dat, err := json.Marshal(respBody)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		return
 	}
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahgr3y/chirpy/internal/database"
+)
+
+func TestRespondWithErr(t *testing.T) {
+
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{database.ErrNotFound, http.StatusNotFound, codeNotFound},
+		{fmt.Errorf("getting user: %w", database.ErrNotFound), http.StatusNotFound, codeNotFound},
+		{database.ErrDuplicateEmail, http.StatusConflict, codeDuplicateEmail},
+		{database.ErrDuplicateHandle, http.StatusConflict, codeDuplicateHandle},
+		{database.ErrForbidden, http.StatusForbidden, codeForbidden},
+		{errInvalidJSON, http.StatusBadRequest, codeInvalidJSON},
+		{errors.New("disk full"), http.StatusInternalServerError, codeInternal},
+	}
+
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		respondWithErr(rec, httptest.NewRequest(http.MethodGet, "/", nil), c.err)
+
+		if rec.Code != c.status {
+			t.Errorf("%v: expecting status %d, got %d", c.err, c.status, rec.Code)
+		}
+		if rec.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%v: expecting problem+json, got %s", c.err, rec.Header().Get("Content-Type"))
+		}
+
+		problem := map[string]any{}
+		err := json.NewDecoder(rec.Body).Decode(&problem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problem["code"] != c.code || problem["status"] != float64(c.status) || problem["title"] != http.StatusText(c.status) {
+			t.Errorf("%v: unexpected problem %v", c.err, problem)
+		}
+	}
+}
+
+func TestValidationError(t *testing.T) {
+
+	rec := httptest.NewRecorder()
+	respondWithAPIError(rec, newValidationError("Invalid chirp", fieldError{Field: "body", Message: "chirp is too long"}))
+
+	type problem struct {
+		Status int          `json:"status"`
+		Detail string       `json:"detail"`
+		Code   string       `json:"code"`
+		Errors []fieldError `json:"errors"`
+	}
+	got := problem{}
+	err := json.NewDecoder(rec.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != http.StatusUnprocessableEntity || got.Code != codeValidation || got.Detail != "Invalid chirp" {
+		t.Errorf("Unexpected problem %+v", got)
+	}
+	if len(got.Errors) != 1 || got.Errors[0] != (fieldError{Field: "body", Message: "chirp is too long"}) {
+		t.Errorf("Unexpected field errors %+v", got.Errors)
+	}
+}
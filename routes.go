@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ahgr3y/chirpy/internal/metrics"
+)
+
+// route is an endpoint of the server. Its pattern follows http.ServeMux.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// newServeMux creates a ServeMux serving the files in rootFilepath
+// under /app/ and every route.
+func (cfg *apiConfig) newServeMux(rootFilepath string) *http.ServeMux {
+
+	serveMux := http.NewServeMux()
+
+	// Add a handler for the root path
+	// By default, FileServer will look for index.html
+	fileserverHandler := cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(rootFilepath))))
+	serveMux.Handle("/app/*", fileserverHandler)
+
+	for _, rt := range cfg.routes() {
+		serveMux.HandleFunc(rt.pattern, rt.handler)
+	}
+
+	return serveMux
+}
+
+// routes returns every endpoint of the server. All of them must be
+// documented in openapi.json, except the deprecated unversioned aliases.
+func (cfg *apiConfig) routes() []route {
+
+	routes := []route{
+		// Register handler for checking server readiness
+		{"/api/healthz", handlerReadinessGet},
+		{"POST /api/healthz", handlerReadinessPost},
+		{"DELETE /api/healthz", handlerReadinessDelete},
+		{"GET /livez", handlerLivez},
+		{"GET /readyz", cfg.handlerReadyz},
+
+		// Register handler describing the API
+		{"GET /api/openapi.json", handlerOpenAPI},
+
+		// Register handler to manage api metrics
+		{"GET /metrics", metrics.Default.Handler().ServeHTTP},
+		{"/admin/metrics", cfg.handlerGetServerHits},
+		{"POST /admin/metrics", cfg.handlerPostServerHits},
+		{"DELETE /admin/metrics", cfg.handlerDeleteServerHits},
+		{"/api/reset", cfg.handlerResetServerHits},
+		{"POST /admin/users/{userID}/unlock", cfg.handlerUnlockUser},
+		{"GET /admin/subscriptions", cfg.handlerGetSubscriptions},
+	}
+
+	// Old clients use the API without a version, which is v1
+	v1 := cfg.apiV1Routes()
+	routes = append(routes, newRouteGroup("/api/v1", middlewareAPIVersion("1")).mount(v1)...)
+	routes = append(routes, newRouteGroup("/api/v2", middlewareAPIVersion("2")).mount(cfg.apiV2Routes(v1))...)
+	routes = append(routes, newRouteGroup("/api", middlewareAPIVersion("1"), middlewareDeprecated(unversionedDeprecatedAt, unversionedSunset)).mount(v1)...)
+
+	return routes
+}
+
+// apiV1Routes returns the endpoints of version 1 of the API,
+// relative to the prefix of their group.
+func (cfg *apiConfig) apiV1Routes() []route {
+
+	return []route{
+		// Register handler to manage chirps
+		{"POST /chirps", cfg.middlewareRateLimit("chirps", cfg.handlerPostChirp)},
+		{"GET /chirps", cfg.handlerGetChirps},
+		{"GET /chirps/stream", cfg.handlerStreamChirps},
+		{"GET /chirps/scheduled", cfg.handlerGetScheduledChirps},
+		{"GET /chirps/{chirpID}", cfg.handlerChirpGetByID},
+		{"PUT /chirps/{chirpID}", cfg.middlewareRateLimit("chirps", cfg.handlerUpdateChirp)},
+		{"DELETE /chirps/{chirpID}", cfg.handlerDeleteChirpByID},
+		{"POST /chirps/{chirpID}/likes", cfg.handlerLikeChirp},
+		{"DELETE /chirps/{chirpID}/likes", cfg.handlerUnlikeChirp},
+
+		// Register handler to manage notifications
+		{"GET /notifications", cfg.handlerGetNotifications},
+		{"POST /notifications/read", cfg.handlerMarkNotificationsRead},
+
+		// Register handler for real-time events
+		{"GET /ws", cfg.handlerWebSocket},
+
+		// Register handler to manage users
+		{"POST /users", cfg.middlewareRateLimit("users", cfg.handlerCreateUser)},
+		{"PUT /users", cfg.handlerUpdateUser},
+		{"GET /users/me", cfg.handlerGetCurrentUser},
+		{"POST /login", cfg.handlerUsersLogin},
+		{"POST /users/verify", cfg.handlerVerifyEmail},
+		{"POST /users/verify/resend", cfg.handlerResendVerification},
+		{"POST /polka/webhooks", cfg.handlerPolkaWebhook},
+
+		// Register handler to manage personal api keys
+		{"POST /users/me/keys", cfg.handlerCreateAPIKey},
+		{"GET /users/me/keys", cfg.handlerGetAPIKeys},
+		{"DELETE /users/me/keys/{keyID}", cfg.handlerRevokeAPIKey},
+
+		// Register handler to manage two-factor authentication
+		{"POST /users/me/2fa/enroll", cfg.handlerEnrollTwoFactor},
+		{"POST /users/me/2fa/confirm", cfg.handlerConfirmTwoFactor},
+		{"POST /login/2fa", cfg.handlerLoginTwoFactor},
+
+		// Register handler to reset forgotten passwords
+		{"POST /password-reset/request", cfg.middlewareRateLimit("password_reset", cfg.handlerRequestPasswordReset)},
+		{"POST /password-reset/confirm", cfg.handlerConfirmPasswordReset},
+
+		// Register handler to manage user tokens
+		{"POST /refresh", cfg.handlerRefreshToken},
+		{"POST /revoke", cfg.handlerRevokeRefreshToken},
+
+		// Register handler to manage outbound webhooks
+		{"POST /webhooks", cfg.handlerCreateWebhook},
+		{"GET /webhooks", cfg.handlerGetWebhooks},
+		{"DELETE /webhooks/{webhookID}", cfg.handlerDeleteWebhook},
+		{"GET /webhooks/{webhookID}/deliveries", cfg.handlerGetWebhookDeliveries},
+	}
+}
+
+// apiV2Routes returns the endpoints of version 2 of the API. It only
+// differs from v1 in the routes whose responses changed shape.
+func (cfg *apiConfig) apiV2Routes(v1 []route) []route {
+
+	changed := map[string]http.HandlerFunc{
+		"GET /chirps": cfg.handlerGetChirpsPage,
+	}
+
+	routes := make([]route, 0, len(v1))
+	for _, rt := range v1 {
+		if handler, ok := changed[rt.pattern]; ok {
+			rt.handler = handler
+		}
+		routes = append(routes, rt)
+	}
+
+	return routes
+}